@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal"
+)
+
+// dump writes a backup archive of the pod in the data directory and store
+// to fn (or stdout if fn is "-"). The pod must not be running. The archive is
+// written to a temporary file that is only renamed to fn once complete so a
+// failed dump never leaves a partial archive behind.
+func dump(fn string) error {
+	db, err := internal.NewStore(store)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var (
+		w io.Writer = os.Stdout
+		f *os.File
+	)
+	if fn != "-" {
+		f, err = ioutil.TempFile(filepath.Dir(fn), filepath.Base(fn)+".tmp-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		w = f
+	}
+
+	manifest, err := internal.DumpPod(data, db, w)
+	if err != nil {
+		return err
+	}
+
+	if f != nil {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(f.Name(), fn); err != nil {
+			return err
+		}
+	}
+
+	log.Infof(
+		"dumped %d users, %d feeds, %d tokens, %d sessions and %d files",
+		manifest.Users, manifest.Feeds, manifest.Tokens, manifest.Sessions, manifest.Files,
+	)
+
+	return nil
+}
+
+// restore restores a backup archive from fn (or stdin if fn is "-") into
+// the data directory and store. The pod must not be running.
+func restore(fn string) error {
+	var r io.Reader = os.Stdin
+	if fn != "-" {
+		f, err := os.Open(fn)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	db, err := internal.NewStore(store)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	manifest, err := internal.RestorePod(data, db, r)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(
+		"restored %d users, %d feeds, %d tokens, %d sessions and %d files from backup (v%d) created %s",
+		manifest.Users, manifest.Feeds, manifest.Tokens, manifest.Sessions, manifest.Files,
+		manifest.Version, manifest.Created,
+	)
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jointwt/twtxt/internal"
+	"github.com/jointwt/twtxt/types"
+)
+
+// lint strictly validates the feed in the file fn (or stdin if fn is "-") or
+// at the url fn and prints every problem found, returns false if the feed
+// has any problems
+func lint(fn string) (bool, error) {
+	var (
+		report *types.LintReport
+		err    error
+	)
+
+	if strings.HasPrefix(fn, "http://") || strings.HasPrefix(fn, "https://") {
+		conf, err := internal.LoadConfig(serverOptions()...)
+		if err != nil {
+			return false, err
+		}
+		if report, err = internal.LintFeed(conf, fn); err != nil {
+			return false, err
+		}
+	} else {
+		var r io.Reader = os.Stdin
+		if fn != "-" {
+			f, err := os.Open(fn)
+			if err != nil {
+				return false, err
+			}
+			defer f.Close()
+			r = f
+		}
+		if report, err = types.LintFile(r, types.Twter{}); err != nil {
+			return false, err
+		}
+	}
+
+	for _, e := range report.Errors {
+		fmt.Printf("%s:%s\n", fn, e.Error())
+	}
+	fmt.Printf("%s: %d lines, %d twts, %d problems\n", fn, report.Lines, report.Twts, len(report.Errors))
+
+	return report.Valid(), nil
+}
@@ -23,6 +23,7 @@ var (
 	bind    string
 	debug   bool
 	version bool
+	dryRun  bool
 
 	// Basic options
 	name        string
@@ -40,14 +41,19 @@ var (
 	// Pod Settings
 	openProfiles      bool
 	openRegistrations bool
+	feedMoveNotices   bool
 
 	// Pod Limits
-	twtsPerPage   int
-	maxTwtLength  int
-	maxUploadSize int64
-	maxFetchLimit int64
-	maxCacheTTL   time.Duration
-	maxCacheItems int
+	twtsPerPage      int
+	maxTwtLength     int
+	maxUploadSize    int64
+	maxFetchLimit    int64
+	minFetchInterval time.Duration
+	maxFetchInterval time.Duration
+	feedRotateAge    time.Duration
+	feedRotateSize   int64
+	maxCacheTTL      time.Duration
+	maxCacheItems    int
 
 	// Pod Secrets
 	apiSigningKey   string
@@ -73,9 +79,12 @@ var (
 )
 
 func init() {
+	flag.Usage = usage
+
 	flag.BoolVarP(&debug, "debug", "D", false, "enable debug logging")
 	flag.StringVarP(&bind, "bind", "b", "0.0.0.0:8000", "[int]:<port> to bind to")
 	flag.BoolVarP(&version, "version", "v", false, "display version information")
+	flag.BoolVar(&dryRun, "dry-run", false, "report what the migrate command would change without changing anything")
 
 	// Basic options
 	flag.StringVarP(&name, "name", "n", internal.DefaultName, "set the pod's name")
@@ -99,6 +108,10 @@ func init() {
 		&openProfiles, "open-profiles", "O", internal.DefaultOpenProfiles,
 		"whether or not to have open user profiles",
 	)
+	flag.BoolVar(
+		&feedMoveNotices, "feed-move-notices", internal.DefaultFeedMoveNotices,
+		"whether or not to post a notice when a followed feed has permanently moved",
+	)
 
 	// Pod Limits
 	flag.IntVarP(
@@ -117,6 +130,22 @@ func init() {
 		&maxFetchLimit, "max-fetch-limit", "F", internal.DefaultMaxFetchLimit,
 		"maximum feed fetch limit in bytes",
 	)
+	flag.DurationVar(
+		&minFetchInterval, "min-fetch-interval", internal.DefaultMinFetchInterval,
+		"minimum interval between fetches of a feed",
+	)
+	flag.DurationVar(
+		&maxFetchInterval, "max-fetch-interval", internal.DefaultMaxFetchInterval,
+		"maximum interval between fetches of a feed",
+	)
+	flag.DurationVar(
+		&feedRotateAge, "feed-rotate-age", internal.DefaultFeedRotateAge,
+		"age of twts to rotate out of local feeds into archive files (0 to disable)",
+	)
+	flag.Int64Var(
+		&feedRotateSize, "feed-rotate-size", internal.DefaultFeedRotateSize,
+		"size in bytes to keep local feeds under by rotating old twts into archive files (0 to disable)",
+	)
 	flag.DurationVarP(
 		&maxCacheTTL, "max-cache-ttl", "C", internal.DefaultMaxCacheTTL,
 		"maximum cache ttl (time-to-live) of cached twts in memory",
@@ -198,6 +227,20 @@ func parseArgs() error {
 	return nil
 }
 
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] [command]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  migrate         apply pending store migrations (see --dry-run)")
+	fmt.Fprintln(os.Stderr, "  dump <file>     dump the pod to a backup archive (- for stdout)")
+	fmt.Fprintln(os.Stderr, "  restore <file>  restore the pod from a backup archive (- for stdin)")
+	fmt.Fprintln(os.Stderr, "  lint <file|url> report problems with a feed (- for stdin)")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "With no command the pod is started.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Options:")
+	flag.PrintDefaults()
+}
+
 func extraServiceInfoFactory(svr *internal.Server) profiler.ExtraServiceInfoRetriever {
 	return func() map[string]interface{} {
 		extraInfo := make(map[string]interface{})
@@ -210,23 +253,9 @@ func extraServiceInfoFactory(svr *internal.Server) profiler.ExtraServiceInfoRetr
 	}
 }
 
-func main() {
-	parseArgs()
-
-	if version {
-		fmt.Printf("twtxt v%s", twtxt.FullVersion())
-		os.Exit(0)
-	}
-
-	if debug {
-		log.SetLevel(log.DebugLevel)
-	} else {
-		log.SetLevel(log.InfoLevel)
-	}
-
-	retwt.DefaultTwtManager()
-
-	svr, err := internal.NewServer(bind,
+// serverOptions returns the server options from the command-line flags
+func serverOptions() []internal.Option {
+	return []internal.Option{
 		// Debug mode
 		internal.WithDebug(debug),
 
@@ -246,12 +275,17 @@ func main() {
 		// Pod Settings
 		internal.WithOpenProfiles(openProfiles),
 		internal.WithOpenRegistrations(openRegistrations),
+		internal.WithFeedMoveNotices(feedMoveNotices),
 
 		// Pod Limits
 		internal.WithTwtsPerPage(twtsPerPage),
 		internal.WithMaxTwtLength(maxTwtLength),
 		internal.WithMaxUploadSize(maxUploadSize),
 		internal.WithMaxFetchLimit(maxFetchLimit),
+		internal.WithMinFetchInterval(minFetchInterval),
+		internal.WithMaxFetchInterval(maxFetchInterval),
+		internal.WithFeedRotateAge(feedRotateAge),
+		internal.WithFeedRotateSize(feedRotateSize),
 		internal.WithMaxCacheTTL(maxCacheTTL),
 		internal.WithMaxCacheItems(maxCacheItems),
 
@@ -276,7 +310,66 @@ func main() {
 		// Whitelists, Sources
 		internal.WithFeedSources(feedSources),
 		internal.WithWhitelistedDomains(whitelistedDomains),
-	)
+	}
+}
+
+func main() {
+	parseArgs()
+
+	if version {
+		fmt.Printf("twtxt v%s", twtxt.FullVersion())
+		os.Exit(0)
+	}
+
+	if debug {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+	}
+
+	retwt.DefaultTwtManager()
+
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+	case "migrate":
+		if err := migrate(dryRun); err != nil {
+			log.WithError(err).Fatal("error migrating store")
+		}
+		os.Exit(0)
+	case "dump", "restore":
+		if flag.NArg() != 2 {
+			usage()
+			os.Exit(2)
+		}
+
+		run := dump
+		if cmd == "restore" {
+			run = restore
+		}
+		if err := run(flag.Arg(1)); err != nil {
+			log.WithError(err).Fatalf("error running %s", cmd)
+		}
+		os.Exit(0)
+	case "lint":
+		if flag.NArg() != 2 {
+			usage()
+			os.Exit(2)
+		}
+
+		valid, err := lint(flag.Arg(1))
+		if err != nil {
+			log.WithError(err).Fatal("error linting feed")
+		}
+		if !valid {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	svr, err := internal.NewServer(bind, serverOptions()...)
 	if err != nil {
 		log.WithError(err).Fatal("error creating server")
 	}
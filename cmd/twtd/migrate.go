@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal"
+)
+
+// migrate applies any pending store migrations, or with dryRun reports what
+// would be changed. The pod must not be running.
+func migrate(dryRun bool) error {
+	conf, err := internal.LoadConfig(serverOptions()...)
+	if err != nil {
+		return err
+	}
+
+	archive, err := internal.NewDiskArchiver(filepath.Join(conf.Data, "archive"))
+	if err != nil {
+		return err
+	}
+
+	cache, err := internal.LoadCache(conf.Data, archive, internal.NewFeedWriter())
+	if err != nil {
+		return err
+	}
+
+	db, err := internal.NewStore(conf.Store)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := internal.NewMigrator(conf, cache, archive, db).Run(dryRun)
+	if err != nil {
+		return err
+	}
+
+	if len(report.Results) == 0 {
+		log.Infof("store is up to date (schema version %d)", report.From)
+		return nil
+	}
+
+	for _, result := range report.Results {
+		log.Infof("migration %d (%s): %d changes", result.Version, result.Description, len(result.Changes))
+	}
+
+	if dryRun {
+		log.Infof(
+			"dry-run: would migrate store from schema version %d to %d with %d changes",
+			report.From, report.To, report.Changes(),
+		)
+	} else {
+		log.Infof(
+			"migrated store from schema version %d to %d with %d changes",
+			report.From, report.To, report.Changes(),
+		)
+	}
+
+	return nil
+}
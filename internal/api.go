@@ -69,6 +69,8 @@ func (a *API) initRoutes() {
 	router.POST("/config", a.PodConfigEndpoint())
 
 	router.POST("/post", a.isAuthorized(a.PostEndpoint()))
+	router.PATCH("/post", a.isAuthorized(a.PostEndpoint()))
+	router.DELETE("/post", a.isAuthorized(a.PostEndpoint()))
 	router.POST("/upload", a.isAuthorized(a.UploadMediaEndpoint()))
 
 	router.GET("/settings", a.isAuthorized(a.SettingsEndpoint()))
@@ -86,6 +88,8 @@ func (a *API) initRoutes() {
 	router.GET("/profile/:nick", a.ProfileEndpoint())
 	router.POST("/fetch-twts", a.FetchTwtsEndpoint())
 	router.POST("/conv", a.ConversationEndpoint())
+	router.POST("/search", a.SearchEndpoint())
+	router.POST("/lint", a.isAuthorized(a.LintEndpoint()))
 
 	router.POST("/external", a.ExternalProfileEndpoint())
 
@@ -269,13 +273,12 @@ func (a *API) RegisterEndpoint() httprouter.Handle {
 
 		recoveryHash := fmt.Sprintf("email:%s", FastHash(email))
 
-		user := &User{
-			Username:  username,
-			Password:  hash,
-			Recovery:  recoveryHash,
-			URL:       URLForUser(a.config, username),
-			CreatedAt: time.Now(),
-		}
+		user := NewUser()
+		user.Username = username
+		user.Password = hash
+		user.Recovery = recoveryHash
+		user.URL = URLForUser(a.config, username)
+		user.CreatedAt = time.Now()
 
 		if err := a.db.SetUser(username, user); err != nil {
 			log.WithError(err).Error("error saving user object for new user")
@@ -283,6 +286,12 @@ func (a *API) RegisterEndpoint() httprouter.Handle {
 			return
 		}
 
+		if username == a.config.AdminUser {
+			if err := AttachSpecialFeeds(a.config, a.db, user); err != nil {
+				log.WithError(err).Warn("error creating special feeds for admin user")
+			}
+		}
+
 		log.Infof("user registered: %v", user)
 	}
 }
@@ -387,39 +396,71 @@ func (a *API) PostEndpoint() httprouter.Handle {
 			return
 		}
 
-		text := CleanTwt(req.Text)
-		if text == "" {
-			log.Warn("no text provided for post")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
-			return
+		feed := user.Username
+		if req.PostAs != "" && req.PostAs != me {
+			if !user.OwnsFeed(req.PostAs) {
+				log.WithError(ErrFeedImposter).Errorf("error posting as %s", req.PostAs)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			feed = NormalizeFeedName(req.PostAs)
 		}
 
-		switch req.PostAs {
-		case "", me:
-			_, err = AppendTwt(a.config, a.db, user, text)
+		var (
+			old types.Twt
+			twt types.Twt
+		)
+
+		switch r.Method {
+		case http.MethodDelete:
+			if req.Hash == "" {
+				log.Warn("no hash provided for delete")
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			old, err = DeleteTwt(a.config, a.cache.feedWriter, feed, req.Hash)
 		default:
-			if user.OwnsFeed(req.PostAs) {
-				_, err = AppendSpecial(a.config, a.db, req.PostAs, text)
-			} else {
-				err = ErrFeedImposter
+			text := CleanTwt(req.Text)
+			if text == "" {
+				log.Warn("no text provided for post")
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			// Editing (with a hash) keeps the twt where it is in the feed
+			// along with its Created timestamp
+			switch {
+			case req.Hash != "" && feed == user.Username:
+				old, twt, err = EditTwt(a.config, a.cache.feedWriter, a.db, user, req.Hash, text)
+			case req.Hash != "":
+				old, twt, err = EditSpecial(a.config, a.cache.feedWriter, a.db, feed, req.Hash, text)
+			case r.Method == http.MethodPatch:
+				log.Warn("no hash provided for edit")
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			case feed == user.Username:
+				_, err = AppendTwt(a.config, a.cache.feedWriter, a.db, user, text)
+			default:
+				_, err = AppendSpecial(a.config, a.cache.feedWriter, a.db, feed, text)
 			}
 		}
 
 		if err != nil {
 			log.WithError(err).Error("error posting twt")
-			if err == ErrFeedImposter {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			if err == ErrTwtNotFound {
+				http.Error(w, "Twt Not Found", http.StatusNotFound)
 			} else {
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 			return
 		}
 
-		// Update user's own timeline with their own new post.
-		a.cache.FetchTwts(a.config, a.archive, user.Source(), nil)
+		if old != nil {
+			a.cache.UpdateArchived(a.archive, old, twt)
+		}
 
-		// Re-populate/Warm cache with local twts for this pod
-		a.cache.GetByPrefix(a.config.BaseURL, true)
+		// The feed written is loaded into the cache by the FeedWriter's
+		// Written hook, see setupFeedWriter()
 
 		// No real response
 		w.Header().Set("Content-Type", "application/json")
@@ -439,17 +480,9 @@ func (a *API) TimelineEndpoint() httprouter.Handle {
 			return
 		}
 
-		var twts types.Twts
-
-		for feed := range user.Sources() {
-			twts = append(twts, a.cache.GetByURL(feed.URL)...)
-		}
-
-		sort.Sort(twts)
-
 		var pagedTwts types.Twts
 
-		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager := paginator.New(timelineAdapter{cache: a.cache, feeds: user.Sources()}, a.config.TwtsPerPage)
 		pager.SetPage(req.Page)
 
 		if err = pager.Results(&pagedTwts); err != nil {
@@ -525,6 +558,111 @@ func (a *API) DiscoverEndpoint() httprouter.Handle {
 	}
 }
 
+// SearchEndpoint ...
+func (a *API) SearchEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		loggedInUser := a.getLoggedInUser(r)
+
+		req, err := types.NewSearchRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing search request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		var (
+			twts   types.Twts
+			cursor string
+		)
+
+		switch {
+		case req.Query != "":
+			query, err := ParseSearchQuery(req.Query)
+			if err != nil {
+				log.WithError(err).Errorf("error parsing search query %q", req.Query)
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			twts, cursor, err = a.cache.Search(a.archive, query, req.Cursor, a.config.TwtsPerPage)
+			if err != nil {
+				log.WithError(err).Errorf("error searching for %q", req.Query)
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+		case req.Tag != "":
+			twts, cursor, err = a.cache.GetByTag(req.Tag, req.Cursor, a.config.TwtsPerPage)
+			if err != nil {
+				log.WithError(err).Errorf("error searching for tag %s", req.Tag)
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		res := types.SearchResponse{
+			Twts:   a.formatTwtText(FilterTwts(loggedInUser, twts)),
+			Cursor: cursor,
+		}
+
+		body, err := res.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// LintEndpoint ...
+func (a *API) LintEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		req, err := types.NewLintRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing lint request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		var report *types.LintReport
+
+		switch {
+		case req.URL != "":
+			if report, err = LintFeed(a.config, req.URL); err != nil {
+				log.WithError(err).Errorf("error linting feed %s", req.URL)
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+		case req.Feed != "":
+			if report, err = types.LintFile(strings.NewReader(req.Feed), types.Twter{}); err != nil {
+				log.WithError(err).Error("error linting feed")
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		res := types.LintResponse{Valid: report.Valid(), Report: report}
+
+		body, err := res.Bytes()
+		if err != nil {
+			log.WithError(err).Error("error serializing response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
 // MentionsEndpoint ...
 func (a *API) MentionsEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -537,8 +675,7 @@ func (a *API) MentionsEndpoint() httprouter.Handle {
 
 		user := r.Context().Value(UserContextKey).(*User)
 
-		twts := a.cache.GetMentions(user)
-		sort.Sort(twts)
+		twts := a.cache.GetMentions(a.config, user)
 
 		var pagedTwts types.Twts
 
@@ -599,48 +736,39 @@ func (a *API) FollowEndpoint() httprouter.Handle {
 			return
 		}
 
-		if err := a.db.SetUser(user.Username, user); err != nil {
+		// The user and the local user or feed they follow (if any) are
+		// updated together so the follow graph stays consistent.
+		batch := NewBatch()
+
+		if err := batch.SetUser(user.Username, user); err != nil {
 			log.WithError(err).Error("error saving user object")
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
+		var followee string
+
 		if strings.HasPrefix(url, a.config.BaseURL) {
 			url = UserURL(url)
 			nick := NormalizeUsername(filepath.Base(url))
 
 			if a.db.HasUser(nick) {
-				followee, err := a.db.GetUser(nick)
+				followeeUser, err := a.db.GetUser(nick)
 				if err != nil {
 					log.WithError(err).Errorf("error loading user object for %s", nick)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
 
-				if followee.Followers == nil {
-					followee.Followers = make(map[string]string)
-				}
-
-				followee.Followers[user.Username] = user.URL
+				followeeUser.Followers[user.Username] = user.URL
 
-				if err := a.db.SetUser(followee.Username, followee); err != nil {
-					log.WithError(err).Warnf("error updating user object for followee %s", followee.Username)
+				if err := batch.SetUser(followeeUser.Username, followeeUser); err != nil {
+					log.WithError(err).Warnf("error updating user object for followee %s", followeeUser.Username)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
 
-				if _, err := AppendSpecial(
-					a.config, a.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						followee.Username, URLForUser(a.config, followee.Username),
-						user.Username, URLForUser(a.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
+				followee = followeeUser.Username
 			} else if a.db.HasFeed(nick) {
 				feed, err := a.db.GetFeed(nick)
 				if err != nil {
@@ -651,24 +779,34 @@ func (a *API) FollowEndpoint() httprouter.Handle {
 
 				feed.Followers[user.Username] = user.URL
 
-				if err := a.db.SetFeed(feed.Name, feed); err != nil {
+				if err := batch.SetFeed(feed.Name, feed); err != nil {
 					log.WithError(err).Warnf("error updating user object for followee %s", feed.Name)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
 
-				if _, err := AppendSpecial(
-					a.config, a.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						feed.Name, URLForUser(a.config, feed.Name),
-						user.Username, URLForUser(a.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
+				followee = feed.Name
+			}
+		}
+
+		if err := a.db.Commit(batch); err != nil {
+			log.WithError(err).Errorf("error saving follow of %s by %s", url, user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if followee != "" {
+			if _, err := AppendSpecial(
+				a.config, a.cache.feedWriter, a.db,
+				twtxtBot,
+				fmt.Sprintf(
+					"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
+					followee, URLForUser(a.config, followee),
+					user.Username, URLForUser(a.config, user.Username),
+					"twtxt", twtxt.FullVersion(),
+				),
+			); err != nil {
+				log.WithError(err).Warnf("error appending special FOLLOW post")
 			}
 		}
 
@@ -712,40 +850,66 @@ func (a *API) UnfollowEndpoint() httprouter.Handle {
 
 		delete(user.Following, nick)
 
-		if err := a.db.SetUser(user.Username, user); err != nil {
+		batch := NewBatch()
+
+		if err := batch.SetUser(user.Username, user); err != nil {
 			log.WithError(err).Warnf("error updating user object for user  %s", user.Username)
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
+		var followee string
+
 		if strings.HasPrefix(url, a.config.BaseURL) {
 			url = UserURL(url)
 			nick := NormalizeUsername(filepath.Base(url))
-			followee, err := a.db.GetUser(nick)
-			if err != nil {
-				log.WithError(err).Warnf("error loading user object for followee %s", nick)
-			} else {
-				if followee.Followers != nil {
-					delete(followee.Followers, user.Username)
-					if err := a.db.SetUser(followee.Username, followee); err != nil {
-						log.WithError(err).Warnf("error updating user object for followee %s", followee.Username)
+
+			if a.db.HasUser(nick) {
+				followeeUser, err := a.db.GetUser(nick)
+				if err != nil {
+					log.WithError(err).Warnf("error loading user object for followee %s", nick)
+				} else {
+					delete(followeeUser.Followers, user.Username)
+					if err := batch.SetUser(followeeUser.Username, followeeUser); err != nil {
+						log.WithError(err).Warnf("error updating user object for followee %s", followeeUser.Username)
 					}
+					followee = followeeUser.Username
 				}
-				if _, err := AppendSpecial(
-					a.config, a.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"UNFOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						followee.Username, URLForUser(a.config, followee.Username),
-						user.Username, URLForUser(a.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
+			} else if a.db.HasFeed(nick) {
+				feed, err := a.db.GetFeed(nick)
+				if err != nil {
+					log.WithError(err).Warnf("error loading feed object for followee %s", nick)
+				} else {
+					delete(feed.Followers, user.Username)
+					if err := batch.SetFeed(feed.Name, feed); err != nil {
+						log.WithError(err).Warnf("error updating feed object for followee %s", feed.Name)
+					}
+					followee = feed.Name
 				}
 			}
 		}
 
+		if err := a.db.Commit(batch); err != nil {
+			log.WithError(err).Errorf("error saving unfollow of %s by %s", url, user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if followee != "" {
+			if _, err := AppendSpecial(
+				a.config, a.cache.feedWriter, a.db,
+				twtxtBot,
+				fmt.Sprintf(
+					"UNFOLLOW: @<%s %s> from @<%s %s> using %s/%s",
+					followee, URLForUser(a.config, followee),
+					user.Username, URLForUser(a.config, user.Username),
+					"twtxt", twtxt.FullVersion(),
+				),
+			); err != nil {
+				log.WithError(err).Warnf("error appending special FOLLOW post")
+			}
+		}
+
 		// No real response
 		w.Header().Set("Content-Type", "application/json")
 		_, _ = w.Write([]byte(`{}`))
@@ -1125,16 +1289,13 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 
 		getTweetsByHash := func(hash string, replyTo types.Twt) types.Twts {
 			var result types.Twts
-			seen := make(map[string]bool)
-			// TODO: Improve this by making this an O(1) lookup on the tag
-			for _, twt := range a.cache.GetAll() {
-				var lis types.TagList = twt.Tags()
-				if HasString(UniqStrings(lis.Tags()), hash) && !seen[twt.Hash()] {
+			for _, twt := range a.cache.GetReplies(a.archive, hash) {
+				// Leave out other twts whose hashes collide with replyTo
+				if twt.Hash() != replyTo.Hash() || sameTwt(twt, replyTo) {
 					result = append(result, twt)
-					seen[twt.Hash()] = true
 				}
 			}
-			if !seen[replyTo.Hash()] {
+			if !hasTwt(result, replyTo) {
 				result = append(result, replyTo)
 			}
 			return result
@@ -1282,6 +1443,12 @@ func (a *API) ExternalProfileEndpoint() httprouter.Handle {
 			nick = "unknown"
 		}
 
+		// Prefer what the feed declares about itself
+		meta := a.cache.GetMetadata(url)
+		if meta != nil && meta.Nick != "" {
+			nick = meta.Nick
+		}
+
 		profileResponse := types.ProfileResponse{}
 
 		profileResponse.Profile = types.Profile{
@@ -1294,6 +1461,12 @@ func (a *API) ExternalProfileEndpoint() httprouter.Handle {
 			Muted:      loggedInUser.HasMuted(url),
 		}
 
+		if meta != nil {
+			profileResponse.Profile.Tagline = meta.Description
+			profileResponse.Profile.Following = meta.Following()
+			profileResponse.Profile.Links = meta.Links
+		}
+
 		profileResponse.Twter = types.Twter{
 			Nick:   nick,
 			Avatar: URLForExternalAvatar(a.config, url),
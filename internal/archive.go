@@ -32,8 +32,10 @@ type Archiver interface {
 	Del(hash string) error
 	Has(hash string) bool
 	Get(hash string) (types.Twt, error)
+	GetAll(hash string) (types.Twts, error)
 	Archive(twt types.Twt) error
 	Count() (int, error)
+	Walk(fn func(twt types.Twt) error) error
 }
 
 // NullArchiver implements Archiver using dummy implementation stubs
@@ -43,15 +45,18 @@ func NewNullArchiver() (Archiver, error) {
 	return &NullArchiver{}, nil
 }
 
-func (a *NullArchiver) Del(hash string) error              { return nil }
-func (a *NullArchiver) Has(hash string) bool               { return false }
-func (a *NullArchiver) Get(hash string) (types.Twt, error) { return types.NilTwt, nil }
-func (a *NullArchiver) Archive(twt types.Twt) error        { return nil }
-func (a *NullArchiver) Count() (int, error)                { return 0, nil }
+func (a *NullArchiver) Del(hash string) error                  { return nil }
+func (a *NullArchiver) Has(hash string) bool                   { return false }
+func (a *NullArchiver) Get(hash string) (types.Twt, error)     { return types.NilTwt, nil }
+func (a *NullArchiver) GetAll(hash string) (types.Twts, error) { return nil, nil }
+func (a *NullArchiver) Archive(twt types.Twt) error            { return nil }
+func (a *NullArchiver) Count() (int, error)                    { return 0, nil }
+func (a *NullArchiver) Walk(fn func(types.Twt) error) error    { return nil }
 
 // DiskArchiver implements Archiver using an on-disk hash layout directory
 // structure with one directory per 2-letter hash sequence with a single
-// JSON encoded file per twt.
+// JSON encoded file per twt. Twts whose hashes collide with that of a twt
+// already archived are archived alongside it, see candidatePath().
 type DiskArchiver struct {
 	path string
 }
@@ -84,6 +89,24 @@ func (a *DiskArchiver) makePath(hash string) (string, error) {
 	return filepath.Join(components...), nil
 }
 
+// candidatePath returns the path of the nth twt archived with the hash whose
+// path is fn, the first is archived at fn and the others as <hash>.<n>.json
+func (a *DiskArchiver) candidatePath(fn string, n int) string {
+	if n == 0 {
+		return fn
+	}
+	return fmt.Sprintf("%s.%d.json", strings.TrimSuffix(fn, ".json"), n)
+}
+
+func (a *DiskArchiver) readTwt(fn string) (types.Twt, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return types.NilTwt, err
+	}
+
+	return types.DecodeJSON(data)
+}
+
 func (a *DiskArchiver) fileExists(fn string) bool {
 	if _, err := os.Stat(fn); err != nil {
 		return false
@@ -98,8 +121,10 @@ func (a *DiskArchiver) Del(hash string) error {
 		return err
 	}
 
-	if a.fileExists(fn) {
-		return os.Remove(fn)
+	for n := 0; a.fileExists(a.candidatePath(fn, n)); n++ {
+		if err := os.Remove(a.candidatePath(fn, n)); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -127,19 +152,39 @@ func (a *DiskArchiver) Get(hash string) (types.Twt, error) {
 		return types.NilTwt, ErrTwtNotArchived
 	}
 
-	data, err := ioutil.ReadFile(fn)
+	twt, err := a.readTwt(fn)
 	if err != nil {
 		log.WithError(err).Errorf("error reading archived twt %s", hash)
 		return types.NilTwt, err
 	}
 
-	var twt types.Twt
-	if twt, err = types.DecodeJSON(data); err != nil {
-		log.WithError(err).Errorf("error decoding archived twt %s", hash)
-		return twt, err
+	return twt, nil
+}
+
+// GetAll returns every twt archived with the given hash, which is more than
+// one if the hashes of different twts collide
+func (a *DiskArchiver) GetAll(hash string) (types.Twts, error) {
+	fn, err := a.makePath(hash)
+	if err != nil {
+		log.WithError(err).Errorf("error computing archive file for twt %s", hash)
+		return nil, err
 	}
 
-	return twt, nil
+	var twts types.Twts
+	for n := 0; a.fileExists(a.candidatePath(fn, n)); n++ {
+		twt, err := a.readTwt(a.candidatePath(fn, n))
+		if err != nil {
+			log.WithError(err).Errorf("error reading archived twt %s", hash)
+			return nil, err
+		}
+		twts = append(twts, twt)
+	}
+
+	if len(twts) == 0 {
+		return nil, ErrTwtNotArchived
+	}
+
+	return twts, nil
 }
 
 func (a *DiskArchiver) Archive(twt types.Twt) error {
@@ -149,9 +194,23 @@ func (a *DiskArchiver) Archive(twt types.Twt) error {
 		return err
 	}
 
-	if a.fileExists(fn) {
-		log.Warnf("archived twt %s already exists", twt.Hash())
-		return ErrTwtAlreadyArchived
+	n := 0
+	for ; a.fileExists(a.candidatePath(fn, n)); n++ {
+		archived, err := a.readTwt(a.candidatePath(fn, n))
+		if err != nil {
+			log.WithError(err).Errorf("error reading archived twt %s", twt.Hash())
+			return err
+		}
+		if sameTwt(archived, twt) {
+			return ErrTwtAlreadyArchived
+		}
+	}
+	if n > 0 {
+		log.Warnf(
+			"hash collision: twt %s by %s collides with %d archived twt(s)",
+			twt.Hash(), twt.Twter().URL, n,
+		)
+		fn = a.candidatePath(fn, n)
 	}
 
 	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
@@ -193,3 +252,32 @@ func (a *DiskArchiver) Count() (int, error) {
 
 	return count, err
 }
+
+// Walk calls fn for every archived twt, stopping at the first error returned
+// by fn. Twts that cannot be read or decoded are skipped.
+func (a *DiskArchiver) Walk(fn func(twt types.Twt) error) error {
+	return filepath.Walk(a.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.WithError(err).Error("error walking archive directory")
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(info.Name()) != ".json" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.WithError(err).Warnf("error reading archived twt %s", path)
+			return nil
+		}
+
+		twt, err := types.DecodeJSON(data)
+		if err != nil {
+			log.WithError(err).Warnf("error decoding archived twt %s", path)
+			return nil
+		}
+
+		return fn(twt)
+	})
+}
@@ -0,0 +1,547 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt"
+	"github.com/jointwt/twtxt/internal/session"
+)
+
+const (
+	// BackupVersion is the version of the backup archive format written by
+	// DumpPod. RestorePod refuses archives with a newer version.
+	BackupVersion = 1
+
+	backupManifest     = "MANIFEST.json"
+	backupUsersDir     = "users"
+	backupFeedsDir     = "feeds"
+	backupTokensDir    = "tokens"
+	backupSessionsDir  = "sessions"
+	backupFilesDir     = "files"
+	backupSettingsFile = "settings.yaml"
+)
+
+var (
+	ErrBackupCorrupt     = errors.New("error: backup archive is corrupt")
+	ErrBackupNewer       = errors.New("error: backup archive is from a newer version")
+	ErrBackupNoManifest  = errors.New("error: backup archive has no manifest")
+	ErrBackupInvalidPath = errors.New("error: backup archive contains an invalid path")
+)
+
+// backupDataDirs are the directories (relative to the data directory) whose
+// contents are included in a backup archive.
+var backupDataDirs = []string{feedsDir, archivedFeedsDir, blogsDir, mediaDir}
+
+// BackupManifest describes the contents of a backup archive and is written
+// as the last entry of the archive so it can carry the checksum of every
+// other entry.
+type BackupManifest struct {
+	Version int
+	Created time.Time
+	Twtxt   string
+
+	// SchemaVersion is the store schema version (see Migrations)
+	SchemaVersion int
+
+	Users    int
+	Feeds    int
+	Tokens   int
+	Sessions int
+	Files    int
+
+	// Checksums maps every entry in the archive to its SHA256 checksum
+	Checksums map[string]string
+}
+
+type backupWriter struct {
+	tw       *tar.Writer
+	manifest *BackupManifest
+}
+
+func (bw *backupWriter) write(name string, size int64, modTime time.Time, r io.Reader) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	}
+	if err := bw.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(bw.tw, io.TeeReader(r, h)); err != nil {
+		return err
+	}
+	bw.manifest.Checksums[name] = hex.EncodeToString(h.Sum(nil))
+
+	return nil
+}
+
+func (bw *backupWriter) writeBytes(name string, data []byte) error {
+	return bw.write(name, int64(len(data)), time.Now(), bytes.NewReader(data))
+}
+
+func (bw *backupWriter) writeFile(name, fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return bw.write(name, stat.Size(), stat.ModTime(), f)
+}
+
+// DumpPod writes a versioned backup archive of the pod's users, feeds,
+// tokens, sessions, settings and on-disk data (local feeds, blog posts and
+// media) found in the data directory to w.
+func DumpPod(data string, db Store, w io.Writer) (*BackupManifest, error) {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	bw := &backupWriter{
+		tw: tw,
+		manifest: &BackupManifest{
+			Version:   BackupVersion,
+			Created:   time.Now(),
+			Twtxt:     twtxt.FullVersion(),
+			Checksums: make(map[string]string),
+		},
+	}
+
+	schemaVersion, err := db.GetSchemaVersion()
+	if err != nil {
+		log.WithError(err).Error("error reading schema version")
+		return nil, err
+	}
+	bw.manifest.SchemaVersion = schemaVersion
+
+	users, err := db.GetAllUsers()
+	if err != nil {
+		log.WithError(err).Error("error loading users")
+		return nil, err
+	}
+	for _, user := range users {
+		buf, err := user.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := bw.writeBytes(path.Join(backupUsersDir, user.Username), buf); err != nil {
+			return nil, err
+		}
+		bw.manifest.Users++
+
+		// There is no way to enumerate all tokens in a Store, so we dump the
+		// tokens of every user instead.
+		tokens, err := db.GetUserTokens(user)
+		if err != nil {
+			log.WithError(err).Warnf("error loading tokens for %s", user.Username)
+		}
+		for _, token := range tokens {
+			buf, err := token.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			if err := bw.writeBytes(path.Join(backupTokensDir, token.Signature), buf); err != nil {
+				return nil, err
+			}
+			bw.manifest.Tokens++
+		}
+	}
+
+	feeds, err := db.GetAllFeeds()
+	if err != nil {
+		log.WithError(err).Error("error loading feeds")
+		return nil, err
+	}
+	for _, feed := range feeds {
+		buf, err := feed.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := bw.writeBytes(path.Join(backupFeedsDir, feed.Name), buf); err != nil {
+			return nil, err
+		}
+		bw.manifest.Feeds++
+	}
+
+	sessions, err := db.GetAllSessions()
+	if err != nil {
+		log.WithError(err).Error("error loading sessions")
+		return nil, err
+	}
+	for _, sess := range sessions {
+		buf, err := sess.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := bw.writeBytes(path.Join(backupSessionsDir, sess.ID), buf); err != nil {
+			return nil, err
+		}
+		bw.manifest.Sessions++
+	}
+
+	fn := filepath.Join(data, backupSettingsFile)
+	if FileExists(fn) {
+		if err := bw.writeFile(backupSettingsFile, fn); err != nil {
+			log.WithError(err).Error("error writing settings")
+			return nil, err
+		}
+	}
+
+	for _, dir := range backupDataDirs {
+		root := filepath.Join(data, dir)
+		if !FileExists(root) {
+			continue
+		}
+
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(data, p)
+			if err != nil {
+				return err
+			}
+			name := path.Join(backupFilesDir, filepath.ToSlash(rel))
+			if err := bw.writeFile(name, p); err != nil {
+				return err
+			}
+			bw.manifest.Files++
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).Errorf("error writing %s", dir)
+			return nil, err
+		}
+	}
+
+	manifest, err := json.Marshal(bw.manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    backupManifest,
+		Mode:    0644,
+		Size:    int64(len(manifest)),
+		ModTime: bw.manifest.Created,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return bw.manifest, nil
+}
+
+// restoredFiles are the files moved into the data directory by
+// restoreFiles, along with where the files they replaced were moved to
+type restoredFiles []restoredFile
+
+type restoredFile struct {
+	dst  string
+	orig string // "" if there was no file at dst
+}
+
+// rollback moves the files restored back out of the data directory and the
+// files they replaced back in, most recently restored first
+func (restored restoredFiles) rollback() {
+	for i := len(restored) - 1; i >= 0; i-- {
+		file := restored[i]
+		var err error
+		if file.orig != "" {
+			err = os.Rename(file.orig, file.dst)
+		} else {
+			err = os.Remove(file.dst)
+		}
+		if err != nil {
+			log.WithError(err).Errorf("error rolling back restore of %s", file.dst)
+		}
+	}
+}
+
+// restoreFiles moves the files (named as in the archive) staged in staging
+// into place in the data directory. The files they replace are moved into
+// staging so the restore can be rolled back. The files restored so far are
+// returned even if an error is.
+func restoreFiles(data, staging string, files []string) (restoredFiles, error) {
+	var restored restoredFiles
+
+	for i, name := range files {
+		rel := strings.TrimPrefix(name, backupFilesDir+"/")
+		dst, err := securejoin.SecureJoin(data, filepath.FromSlash(rel))
+		if err != nil {
+			return restored, ErrBackupInvalidPath
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return restored, err
+		}
+
+		file := restoredFile{dst: dst}
+		if FileExists(dst) {
+			file.orig = filepath.Join(staging, ".orig", strconv.Itoa(i))
+			if err := os.MkdirAll(filepath.Dir(file.orig), 0755); err != nil {
+				return restored, err
+			}
+			if err := os.Rename(dst, file.orig); err != nil {
+				log.WithError(err).Errorf("error moving aside %s", rel)
+				return restored, err
+			}
+		}
+
+		if err := os.Rename(filepath.Join(staging, filepath.FromSlash(name)), dst); err != nil {
+			log.WithError(err).Errorf("error restoring %s", rel)
+			if file.orig != "" {
+				if err := os.Rename(file.orig, dst); err != nil {
+					log.WithError(err).Errorf("error moving back %s", rel)
+				}
+			}
+			return restored, err
+		}
+		restored = append(restored, file)
+	}
+
+	return restored, nil
+}
+
+// RestorePod restores a backup archive written by DumpPod from r into the
+// given Store and data directory.
+//
+// The whole archive is read and verified against its manifest before
+// anything is written to the Store or data directory, so a corrupt,
+// truncated or newer-version archive is refused without side-effects. The
+// users, feeds and tokens are then committed in one batch and the files
+// restored are moved back out again if that fails.
+func RestorePod(data string, db Store, r io.Reader) (*BackupManifest, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		log.WithError(err).Error("error reading backup archive")
+		return nil, ErrBackupCorrupt
+	}
+	defer gr.Close()
+
+	if err := os.MkdirAll(data, 0755); err != nil {
+		return nil, err
+	}
+
+	// Files are staged in the data directory so they can be renamed into
+	// place once the archive has been verified.
+	staging, err := ioutil.TempDir(data, ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	var (
+		manifest  *BackupManifest
+		records   = make(map[string][]byte)
+		files     []string
+		checksums = make(map[string]string)
+	)
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.WithError(err).Error("error reading backup archive")
+			return nil, ErrBackupCorrupt
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, ErrBackupInvalidPath
+		}
+
+		if name == backupManifest {
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				log.WithError(err).Error("error decoding backup manifest")
+				return nil, ErrBackupCorrupt
+			}
+			continue
+		}
+
+		h := sha256.New()
+
+		if strings.HasPrefix(name, backupFilesDir+"/") || name == backupSettingsFile {
+			fn, err := securejoin.SecureJoin(staging, name)
+			if err != nil {
+				return nil, ErrBackupInvalidPath
+			}
+			if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+				return nil, err
+			}
+			f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(f, io.TeeReader(tr, h))
+			f.Close()
+			if err != nil {
+				log.WithError(err).Error("error reading backup archive")
+				return nil, ErrBackupCorrupt
+			}
+			files = append(files, name)
+		} else {
+			buf, err := ioutil.ReadAll(io.TeeReader(tr, h))
+			if err != nil {
+				log.WithError(err).Error("error reading backup archive")
+				return nil, ErrBackupCorrupt
+			}
+			records[name] = buf
+		}
+
+		checksums[name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	if manifest == nil {
+		return nil, ErrBackupNoManifest
+	}
+	if manifest.Version > BackupVersion || manifest.SchemaVersion > LatestSchemaVersion() {
+		return nil, ErrBackupNewer
+	}
+	if len(manifest.Checksums) != len(checksums) {
+		log.Errorf(
+			"backup archive has %d entries but manifest lists %d",
+			len(checksums), len(manifest.Checksums),
+		)
+		return nil, ErrBackupCorrupt
+	}
+	for name, sum := range manifest.Checksums {
+		if checksums[name] != sum {
+			log.Errorf("checksum mismatch for %s", name)
+			return nil, ErrBackupCorrupt
+		}
+	}
+
+	// Decode everything before writing anything
+	var (
+		users    []*User
+		feeds    []*Feed
+		tokens   []*Token
+		sessions []*session.Session
+	)
+	for name, buf := range records {
+		dir, _ := path.Split(name)
+		switch strings.TrimSuffix(dir, "/") {
+		case backupUsersDir:
+			user, err := LoadUser(buf)
+			if err != nil {
+				return nil, fmt.Errorf("error loading user %s: %w", name, err)
+			}
+			users = append(users, user)
+		case backupFeedsDir:
+			feed, err := LoadFeed(buf)
+			if err != nil {
+				return nil, fmt.Errorf("error loading feed %s: %w", name, err)
+			}
+			feeds = append(feeds, feed)
+		case backupTokensDir:
+			token, err := LoadToken(buf)
+			if err != nil {
+				return nil, fmt.Errorf("error loading token %s: %w", name, err)
+			}
+			tokens = append(tokens, token)
+		case backupSessionsDir:
+			sess := session.NewSession(db)
+			if err := session.LoadSession(buf, sess); err != nil {
+				return nil, fmt.Errorf("error loading session %s: %w", name, err)
+			}
+			sessions = append(sessions, sess)
+		default:
+			log.Warnf("ignoring unknown backup entry %s", name)
+		}
+	}
+
+	// Users, feeds and tokens are committed as one batch once the files are
+	// in place, and the files moved back out should committing it fail
+	batch := NewBatch()
+	for _, token := range tokens {
+		if err := batch.SetToken(token.Signature, token); err != nil {
+			return nil, err
+		}
+	}
+	for _, user := range users {
+		if err := batch.SetUser(user.Username, user); err != nil {
+			return nil, err
+		}
+	}
+	for _, feed := range feeds {
+		if err := batch.SetFeed(feed.Name, feed); err != nil {
+			return nil, err
+		}
+	}
+
+	restored, err := restoreFiles(data, staging, files)
+	if err != nil {
+		restored.rollback()
+		return nil, err
+	}
+
+	if err := db.Commit(batch); err != nil {
+		log.WithError(err).Error("error restoring users, feeds and tokens")
+		restored.rollback()
+		return nil, err
+	}
+
+	for _, sess := range sessions {
+		if err := db.SetSession(sess.ID, sess); err != nil {
+			log.WithError(err).Errorf("error restoring session %s", sess.ID)
+			return nil, err
+		}
+	}
+
+	if err := db.SetSchemaVersion(manifest.SchemaVersion); err != nil {
+		log.WithError(err).Error("error restoring schema version")
+		return nil, err
+	}
+
+	if err := db.Sync(); err != nil {
+		log.WithError(err).Error("error syncing store")
+		return nil, err
+	}
+
+	return manifest, nil
+}
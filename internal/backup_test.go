@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/internal/session"
+)
+
+// rewriteBackup returns the backup archive data with each entry replaced by
+// what edit returns for it, or dropped if it returns nil
+func rewriteBackup(t *testing.T, data []byte, edit func(name string, buf []byte) []byte) []byte {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	tr := tar.NewReader(gr)
+
+	out := new(bytes.Buffer)
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		buf, err := ioutil.ReadAll(tr)
+		assert.NoError(t, err)
+
+		if buf = edit(hdr.Name, buf); buf == nil {
+			continue
+		}
+		hdr.Size = int64(len(buf))
+		assert.NoError(t, tw.WriteHeader(hdr))
+		_, err = tw.Write(buf)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gw.Close())
+
+	return out.Bytes()
+}
+
+// editManifest returns the backup archive data with its manifest changed by edit
+func editManifest(t *testing.T, data []byte, edit func(manifest *BackupManifest)) []byte {
+	return rewriteBackup(t, data, func(name string, buf []byte) []byte {
+		if name != backupManifest {
+			return buf
+		}
+		var manifest BackupManifest
+		assert.NoError(t, json.Unmarshal(buf, &manifest))
+		edit(&manifest)
+		buf, err := json.Marshal(manifest)
+		assert.NoError(t, err)
+		return buf
+	})
+}
+
+// failingCommitStore is a Store that fails to commit batches
+type failingCommitStore struct {
+	Store
+}
+
+func (failingCommitStore) Commit(*Batch) error {
+	return errors.New("error: commit failed")
+}
+
+func TestBackup(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "twtxt-backup-*")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, feedsDir), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, feedsDir, "alice"), []byte("2020-12-01T00:00:00Z\tHello World!\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, backupSettingsFile), []byte("open_registrations: true\n"), 0644))
+
+	db := newMemoryStore()
+	assert.NoError(t, db.SetUser("alice", &User{Username: "alice", Tokens: []string{"sig"}}))
+	assert.NoError(t, db.SetToken("sig", &Token{Signature: "sig"}))
+	assert.NoError(t, db.SetFeed("news", &Feed{Name: "news"}))
+	sess := session.NewSession(db)
+	sess.ID = "sid"
+	sess.Data = session.Map{"username": "alice"}
+	assert.NoError(t, db.SetSession(sess.ID, sess))
+	assert.NoError(t, db.SetSchemaVersion(LatestSchemaVersion()))
+
+	buf := new(bytes.Buffer)
+	manifest, err := DumpPod(src, db, buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	backup := buf.Bytes()
+
+	assert.Equal(t, BackupVersion, manifest.Version)
+	assert.Equal(t, 1, manifest.Users)
+	assert.Equal(t, 1, manifest.Feeds)
+	assert.Equal(t, 1, manifest.Tokens)
+	assert.Equal(t, 1, manifest.Sessions)
+	assert.Equal(t, 1, manifest.Files)
+
+	// restore restores backup into a new data directory and store, which is
+	// refused if it fails with err
+	restore := func(t *testing.T, backup []byte, err error) (string, Store) {
+		dst, tmpErr := ioutil.TempDir(tmp, "dst-*")
+		if !assert.NoError(t, tmpErr) {
+			t.FailNow()
+		}
+		restored := newMemoryStore()
+
+		_, restoreErr := RestorePod(dst, restored, bytes.NewReader(backup))
+		if err != nil {
+			assert.Equal(t, err, restoreErr)
+			assert.False(t, restored.HasUser("alice"))
+			assert.False(t, FileExists(filepath.Join(dst, feedsDir, "alice")))
+		} else {
+			assert.NoError(t, restoreErr)
+		}
+
+		return dst, restored
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		assert := assert.New(t)
+
+		dst, restored := restore(t, backup, nil)
+
+		user, err := restored.GetUser("alice")
+		assert.NoError(err)
+		assert.Equal([]string{"sig"}, user.Tokens)
+		assert.True(restored.HasFeed("news"))
+		tokens, err := restored.GetUserTokens(user)
+		assert.NoError(err)
+		assert.Len(tokens, 1)
+		sess, err := restored.GetSession("sid")
+		assert.NoError(err)
+		assert.Equal("alice", sess.Data["username"])
+
+		version, err := restored.GetSchemaVersion()
+		assert.NoError(err)
+		assert.Equal(LatestSchemaVersion(), version)
+
+		feed, err := ioutil.ReadFile(filepath.Join(dst, feedsDir, "alice"))
+		assert.NoError(err)
+		assert.Equal("2020-12-01T00:00:00Z\tHello World!\n", string(feed))
+		assert.True(FileExists(filepath.Join(dst, backupSettingsFile)))
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		corrupt := rewriteBackup(t, backup, func(name string, buf []byte) []byte {
+			if name == "files/feeds/alice" {
+				return []byte("2020-12-01T00:00:00Z\tHello Earth!\n")
+			}
+			return buf
+		})
+		restore(t, corrupt, ErrBackupCorrupt)
+	})
+
+	t.Run("MissingEntry", func(t *testing.T) {
+		missing := editManifest(t, backup, func(manifest *BackupManifest) {
+			manifest.Checksums["users/bob"] = manifest.Checksums["users/alice"]
+		})
+		restore(t, missing, ErrBackupCorrupt)
+	})
+
+	t.Run("NoManifest", func(t *testing.T) {
+		none := rewriteBackup(t, backup, func(name string, buf []byte) []byte {
+			if name == backupManifest {
+				return nil
+			}
+			return buf
+		})
+		restore(t, none, ErrBackupNoManifest)
+	})
+
+	t.Run("NewerBackupVersion", func(t *testing.T) {
+		newer := editManifest(t, backup, func(manifest *BackupManifest) {
+			manifest.Version = BackupVersion + 1
+		})
+		restore(t, newer, ErrBackupNewer)
+	})
+
+	t.Run("NewerSchemaVersion", func(t *testing.T) {
+		newer := editManifest(t, backup, func(manifest *BackupManifest) {
+			manifest.SchemaVersion = LatestSchemaVersion() + 1
+		})
+		restore(t, newer, ErrBackupNewer)
+	})
+
+	t.Run("RollbackFiles", func(t *testing.T) {
+		assert := assert.New(t)
+
+		dst, err := ioutil.TempDir(tmp, "dst-*")
+		assert.NoError(err)
+		assert.NoError(os.MkdirAll(filepath.Join(dst, feedsDir), 0755))
+		fn := filepath.Join(dst, feedsDir, "alice")
+		assert.NoError(ioutil.WriteFile(fn, []byte("existing\n"), 0644))
+
+		restored := newMemoryStore()
+		_, err = RestorePod(dst, failingCommitStore{restored}, bytes.NewReader(backup))
+		assert.Error(err)
+
+		// The files replaced are put back and those added removed again
+		feed, err := ioutil.ReadFile(fn)
+		assert.NoError(err)
+		assert.Equal("existing\n", string(feed))
+		assert.False(FileExists(filepath.Join(dst, backupSettingsFile)))
+		assert.False(restored.HasUser("alice"))
+		assert.False(restored.HasSession("sid"))
+	})
+}
@@ -1,8 +1,12 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/prologic/bitcask"
 	log "github.com/sirupsen/logrus"
@@ -15,10 +19,18 @@ const (
 	sessionsKeyPrefix = "/sessions"
 	usersKeyPrefix    = "/users"
 	tokensKeyPrefix   = "/tokens"
+
+	schemaVersionKey = "/schema/version"
+	batchJournalKey  = "/batch/journal"
+
+	// bitcaskMaxValueSize is the largest value (such as a user with many
+	// followers) that can be stored, bitcask's default is only 64KB
+	bitcaskMaxValueSize = 1 << 24 // 16MB
 )
 
 // BitcaskStore ...
 type BitcaskStore struct {
+	mu sync.Mutex // serializes batch commits and writes to feeds, users and tokens
 	db *bitcask.Bitcask
 }
 
@@ -26,12 +38,190 @@ func newBitcaskStore(path string) (*BitcaskStore, error) {
 	db, err := bitcask.Open(
 		path,
 		bitcask.WithMaxKeySize(256),
+		bitcask.WithMaxValueSize(bitcaskMaxValueSize),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &BitcaskStore{db: db}, nil
+	bs := &BitcaskStore{db: db}
+
+	if err := bs.recoverBatch(); err != nil {
+		log.WithError(err).Error("error recovering pending batch")
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+// journalKey returns the key the nth operation of a batch is journaled as
+func journalKey(n int) []byte {
+	return []byte(fmt.Sprintf("%s/%d", batchJournalKey, n))
+}
+
+// recoverBatch re-applies a batch whose journal was written but which may
+// not have been fully applied (e.g: due to a crash). The batch's operations
+// are journaled one per key and batchJournalKey records how many once they
+// all are, without it the batch was never applied and what was journaled of
+// it is discarded. It is only called when the store is opened, a batch that
+// fails to apply while the store is open is rolled back by Commit.
+func (bs *BitcaskStore) recoverBatch() error {
+	data, err := bs.db.Get([]byte(batchJournalKey))
+	if err == bitcask.ErrKeyNotFound {
+		return bs.clearJournal()
+	} else if err != nil {
+		return err
+	}
+
+	n, err := strconv.Atoi(string(data))
+	if err != nil {
+		return err
+	}
+
+	batch := NewBatch()
+	for i := 0; i < n; i++ {
+		data, err := bs.db.Get(journalKey(i))
+		if err != nil {
+			return err
+		}
+
+		var op BatchOp
+		if err := json.Unmarshal(data, &op); err != nil {
+			return err
+		}
+		batch.Ops = append(batch.Ops, op)
+	}
+
+	log.Warnf("recovering pending batch of %d operations", batch.Len())
+	if err := bs.applyBatch(batch); err != nil {
+		return err
+	}
+
+	return bs.clearJournal()
+}
+
+// clearJournal deletes the journal of the last batch, batchJournalKey first
+// so that a partially deleted journal is never replayed
+func (bs *BitcaskStore) clearJournal() error {
+	if bs.db.Has([]byte(batchJournalKey)) {
+		if err := bs.db.Delete([]byte(batchJournalKey)); err != nil {
+			return err
+		}
+	}
+
+	var keys [][]byte
+	if err := bs.db.Scan([]byte(batchJournalKey+"/"), func(key []byte) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := bs.db.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batchOpKey returns the key op applies to
+func batchOpKey(op BatchOp) []byte {
+	return []byte(fmt.Sprintf("/%s/%s", op.Kind, op.Key))
+}
+
+// undoBatch returns a batch that restores the keys batch applies to, to
+// their current values when applied after it
+func (bs *BitcaskStore) undoBatch(batch *Batch) (*Batch, error) {
+	undo := NewBatch()
+	for i := len(batch.Ops) - 1; i >= 0; i-- {
+		op := batch.Ops[i]
+		data, err := bs.db.Get(batchOpKey(op))
+		if err == bitcask.ErrKeyNotFound {
+			data = nil
+		} else if err != nil {
+			return nil, err
+		}
+		undo.Ops = append(undo.Ops, BatchOp{Kind: op.Kind, Key: op.Key, Data: data})
+	}
+	return undo, nil
+}
+
+func (bs *BitcaskStore) applyBatch(batch *Batch) error {
+	for _, op := range batch.Ops {
+		key := batchOpKey(op)
+		if op.Data == nil {
+			if !bs.db.Has(key) {
+				continue
+			}
+			if err := bs.db.Delete(key); err != nil {
+				return err
+			}
+		} else {
+			if err := bs.db.Put(key, op.Data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// journalBatch writes the journal of batch (see recoverBatch)
+func (bs *BitcaskStore) journalBatch(batch *Batch) error {
+	for i, op := range batch.Ops {
+		data, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		if err := bs.db.Put(journalKey(i), data); err != nil {
+			return err
+		}
+	}
+	if err := bs.db.Put([]byte(batchJournalKey), []byte(strconv.Itoa(batch.Len()))); err != nil {
+		return err
+	}
+	return bs.db.Sync()
+}
+
+// Commit applies the batch all-or-nothing. Bitcask has no transactions so
+// the batch is first written to a journal, one operation per record so that
+// batches of any size can be journaled, which is replayed when the store is
+// next opened should the pod crash part-way through applying it (see
+// recoverBatch). Should applying it fail the keys it changed are restored to
+// the values they had before and the journal discarded.
+func (bs *BitcaskStore) Commit(batch *Batch) error {
+	if err := batch.validate(); err != nil {
+		return err
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	undo, err := bs.undoBatch(batch)
+	if err != nil {
+		return err
+	}
+
+	if err := bs.journalBatch(batch); err != nil {
+		if err := bs.clearJournal(); err != nil {
+			log.WithError(err).Error("error clearing journal")
+		}
+		return err
+	}
+
+	if err := bs.applyBatch(batch); err != nil {
+		log.WithError(err).Error("error applying batch, rolling back")
+		if err := bs.applyBatch(undo); err != nil {
+			log.WithError(err).Error("error rolling back batch (will be recovered on restart)")
+			return err
+		}
+		if err := bs.clearJournal(); err != nil {
+			log.WithError(err).Error("error clearing journal")
+		}
+		return err
+	}
+
+	return bs.clearJournal()
 }
 
 // Sync ...
@@ -67,12 +257,34 @@ func (bs *BitcaskStore) Merge() error {
 	return nil
 }
 
+// GetSchemaVersion ...
+func (bs *BitcaskStore) GetSchemaVersion() (int, error) {
+	data, err := bs.db.Get([]byte(schemaVersionKey))
+	if err == bitcask.ErrKeyNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(data))
+}
+
+// SetSchemaVersion ...
+func (bs *BitcaskStore) SetSchemaVersion(version int) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	return bs.db.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(version)))
+}
+
 func (bs *BitcaskStore) HasFeed(name string) bool {
 	key := []byte(fmt.Sprintf("%s/%s", feedsKeyPrefix, name))
 	return bs.db.Has(key)
 }
 
 func (bs *BitcaskStore) DelFeed(name string) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
 	key := []byte(fmt.Sprintf("%s/%s", feedsKeyPrefix, name))
 	return bs.db.Delete(key)
 }
@@ -93,6 +305,10 @@ func (bs *BitcaskStore) SetFeed(name string, feed *Feed) error {
 	}
 
 	key := []byte(fmt.Sprintf("%s/%s", feedsKeyPrefix, name))
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
 	if err := bs.db.Put(key, data); err != nil {
 		return err
 	}
@@ -116,13 +332,15 @@ func (bs *BitcaskStore) SearchFeeds(prefix string) []string {
 	var keys []string
 
 	if err := bs.db.Scan([]byte(feedsKeyPrefix), func(key []byte) error {
-		if strings.HasPrefix(strings.ToLower(string(key)), prefix) {
-			keys = append(keys, strings.TrimPrefix(string(key), "/feeds/"))
+		name := strings.TrimPrefix(string(key), "/feeds/")
+		if strings.HasPrefix(name, prefix) {
+			keys = append(keys, name)
 		}
 		return nil
 	}); err != nil {
 		log.WithError(err).Error("error scanning")
 	}
+	sort.Strings(keys)
 
 	return keys
 }
@@ -156,6 +374,9 @@ func (bs *BitcaskStore) HasUser(username string) bool {
 }
 
 func (bs *BitcaskStore) DelUser(username string) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
 	key := []byte(fmt.Sprintf("%s/%s", usersKeyPrefix, username))
 	return bs.db.Delete(key)
 }
@@ -176,6 +397,10 @@ func (bs *BitcaskStore) SetUser(username string, user *User) error {
 	}
 
 	key := []byte(fmt.Sprintf("%s/%s", usersKeyPrefix, username))
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
 	if err := bs.db.Put(key, data); err != nil {
 		return err
 	}
@@ -199,13 +424,15 @@ func (bs *BitcaskStore) SearchUsers(prefix string) []string {
 	var keys []string
 
 	if err := bs.db.Scan([]byte(usersKeyPrefix), func(key []byte) error {
-		if strings.HasPrefix(strings.ToLower(string(key)), prefix) {
-			keys = append(keys, strings.TrimPrefix(string(key), "/users/"))
+		name := strings.TrimPrefix(string(key), "/users/")
+		if strings.HasPrefix(name, prefix) {
+			keys = append(keys, name)
 		}
 		return nil
 	}); err != nil {
 		log.WithError(err).Error("error scanning")
 	}
+	sort.Strings(keys)
 
 	return keys
 }
@@ -351,6 +578,10 @@ func (bs *BitcaskStore) SetToken(signature string, tkn *Token) error {
 	}
 
 	key := []byte(fmt.Sprintf("%s/%s", tokensKeyPrefix, signature))
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
 	if err := bs.db.Put(key, data); err != nil {
 		return err
 	}
@@ -358,6 +589,9 @@ func (bs *BitcaskStore) SetToken(signature string, tkn *Token) error {
 }
 
 func (bs *BitcaskStore) DelToken(signature string) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
 	key := []byte(fmt.Sprintf("%s/%s", tokensKeyPrefix, signature))
 	return bs.db.Delete(key)
 }
@@ -33,21 +33,7 @@ func (s *Server) BlogHandler() httprouter.Handle {
 			return
 		}
 
-		getTweetsByTag := func(tag string) types.Twts {
-			var result types.Twts
-			seen := make(map[string]bool)
-			// TODO: Improve this by making this an O(1) lookup on the tag
-			for _, twt := range s.cache.GetAll() {
-				var tags types.TagList = twt.Tags()
-				if HasString(UniqStrings(tags.Tags()), tag) && !seen[twt.Hash()] {
-					result = append(result, twt)
-					seen[twt.Hash()] = true
-				}
-			}
-			return result
-		}
-
-		twts := getTweetsByTag(blogPost.Hash())
+		twts, _, _ := s.cache.GetByTag(blogPost.Hash(), "", 0)
 
 		sort.Sort(sort.Reverse(twts))
 
@@ -420,9 +406,9 @@ func (s *Server) PublishBlogHandler() httprouter.Handle {
 		var twt types.Twt
 
 		if postas == "" || postas == user.Username {
-			twt, err = AppendTwt(s.config, s.db, user, summary)
+			twt, err = AppendTwt(s.config, s.cache.feedWriter, s.db, user, summary)
 		} else {
-			twt, err = AppendSpecial(s.config, s.db, postas, summary)
+			twt, err = AppendSpecial(s.config, s.cache.feedWriter, s.db, postas, summary)
 		}
 
 		if err != nil {
@@ -445,12 +431,6 @@ func (s *Server) PublishBlogHandler() httprouter.Handle {
 		// Update blogs cache
 		s.blogs.Add(blogPost)
 
-		// Update user's own timeline with their own new post.
-		s.cache.FetchTwts(s.config, s.archive, user.Source(), nil)
-
-		// Re-populate/Warm cache with local twts for this pod
-		s.cache.GetByPrefix(s.config.BaseURL, true)
-
 		http.Redirect(w, r, RedirectURL(r, s.config, "/"), http.StatusFound)
 	}
 }
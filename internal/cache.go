@@ -2,7 +2,9 @@ package internal
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,7 +23,15 @@ import (
 
 const (
 	feedCacheFile    = "cache"
-	feedCacheVersion = 1 // increase this if breaking changes occur to cache file.
+	feedCacheDir     = "cache.d"
+	feedStateDir     = "state.d"
+	feedCacheVersion = 2 // increase this if breaking changes occur to cache file.
+)
+
+var (
+	// ErrInvalidCursor is returned when a search cursor does not refer to a
+	// twt in the results being paged through
+	ErrInvalidCursor = errors.New("error: invalid cursor")
 )
 
 // Cached ...
@@ -30,6 +40,20 @@ type Cached struct {
 	cache        types.TwtMap
 	Twts         types.Twts
 	Lastmodified string
+	ETag         string
+
+	// Length is the length in bytes of the feed when it was fetched and Tail
+	// its last bytes, used to fetch only what has been appended since with a
+	// Range request (see requestFeed). Length is 0 if the feed was truncated
+	// by MaxFetchLimit.
+	Length int64
+	Tail   []byte
+
+	// Metadata is what the feed declares about itself in its headers
+	Metadata *types.Metadata
+
+	// modTime is the mtime of a local feed when it was loaded, see LoadFeed()
+	modTime time.Time
 }
 
 // Lookup ...
@@ -56,103 +80,584 @@ func (cached *Cached) Lookup(hash string) (types.Twt, bool) {
 	return types.NilTwt, false
 }
 
-// OldCache ...
-type OldCache map[string]*Cached
+// twtIndex maps a key (such as a tag) to the set of twts (keyed by twtKey
+// so that twts whose hashes collide are both kept) that have that key
+type twtIndex map[string]map[string]types.Twt
+
+func (idx twtIndex) add(key string, twt types.Twt) {
+	twts, ok := idx[key]
+	if !ok {
+		twts = make(map[string]types.Twt)
+		idx[key] = twts
+	}
+	twts[twtKey(twt)] = twt
+}
+
+func (idx twtIndex) remove(key string, twt types.Twt) {
+	twts, ok := idx[key]
+	if !ok {
+		return
+	}
+	delete(twts, twtKey(twt))
+	if len(twts) == 0 {
+		delete(idx, key)
+	}
+}
+
+// archiveTwts archives the twts not already archived and indexes them (see
+// indexArchived) so that permalinks, conversations and searches keep finding
+// them once they are no longer cached, returns the twts archived. A twt whose
+// hash collides with one already archived is archived alongside it.
+func (cache *Cache) archiveTwts(archive Archiver, twts types.Twts) types.Twts {
+	var archived types.Twts
+	for _, twt := range twts {
+		if err := archive.Archive(twt); err == ErrTwtAlreadyArchived {
+			archived = append(archived, twt)
+		} else if err != nil {
+			log.WithError(err).Errorf("error archiving twt %s aborting", twt.Hash())
+			metrics.Counter("archive", "error").Inc()
+		} else {
+			archived = append(archived, twt)
+			metrics.Counter("archive", "size").Inc()
+		}
+	}
+
+	cache.mu.Lock()
+	cache.indexArchived(archived)
+	cache.mu.Unlock()
+
+	return archived
+}
+
+// subjectKey returns the key a twt's subject is indexed by, which is the
+// hash of the twt being replied to for subjects of the form (#hash)
+func subjectKey(subject string) string {
+	if strings.HasPrefix(subject, "(#") && strings.HasSuffix(subject, ")") {
+		return subject[2 : len(subject)-1]
+	}
+	return subject
+}
 
 // Cache ...
 type Cache struct {
 	mu      sync.RWMutex
 	Version int
 	Twts    map[string]*Cached
+
+	// Archived maps a subject to the hashes of archived twts with that
+	// subject so that conversations can be rebuilt after twts have aged out
+	// of the cache into the Archiver. Unlike the indexes below it cannot be
+	// derived from Twts so it is persisted with the cache (and rebuilt from
+	// the Archiver if it is not, see reindexArchived()).
+	Archived map[string]map[string]bool
+
+	// ArchivedTerms maps a search key (see twtSearchKeys) to the hashes of
+	// archived twts with that key so that archived twts can be searched.
+	// Like Archived it is persisted with the cache.
+	ArchivedTerms map[string]map[string]bool
+
+	// Health records the outcome of fetching each feed by url, see
+	// recordFetch(). Like History it is persisted per feed, see Store().
+	Health map[string]*FeedHealth
+
+	// History records the archive files of each feed by url that have been
+	// fetched into the Archiver, see FetchHistory()
+	History map[string]*FeedHistory
+
+	// tags, subjects, mentions (keyed by normalized feed url), terms
+	// (keyed by search key), hashes and the timeline are derived from Twts
+	// and are not persisted, see reindex()
+	hashes   hashIndex
+	tags     twtIndex
+	subjects twtIndex
+	mentions twtIndex
+	terms    twtIndex
+	timeline timeline
+
+	// views holds derived views of the timeline such as the local timeline
+	// keyed by url prefix, see GetByPrefix(). A view is dropped whenever a
+	// feed it covers changes and rebuilt the next time it is used.
+	views map[string]types.Twts
+
+	// dirty holds the urls of feeds whose twts changed (or were deleted)
+	// since the last Store, stateDirty those whose Health or History did and
+	// snapshotDirty whether Archived or ArchivedTerms have changed, see Store()
+	dirty         map[string]bool
+	stateDirty    map[string]bool
+	snapshotDirty bool
+
+	// moves holds feeds that have permanently moved (old url to new url)
+	// that are yet to be applied to the Store, see FeedMoves()
+	moves map[string]string
+
+	// feedWriter is the FeedWriter local feeds are written through and so
+	// read through, see LoadFeed()
+	feedWriter *FeedWriter
 }
 
-// Store ...
+// cacheSnapshot is what is persisted to feedCacheFile, the twts of each feed
+// are persisted separately as a feedSnapshot in feedCacheDir and the health
+// and history of each feed as a feedStateSnapshot in feedStateDir
+type cacheSnapshot struct {
+	Version       int
+	Archived      map[string]map[string]bool
+	ArchivedTerms map[string]map[string]bool
+}
+
+// feedSnapshot ...
+type feedSnapshot struct {
+	URL    string
+	Cached *Cached
+}
+
+// feedStateSnapshot ...
+type feedStateSnapshot struct {
+	URL     string
+	Health  *FeedHealth
+	History *FeedHistory
+}
+
+// feedSnapshotFile returns the name of the file a feed's snapshot is stored in
+func feedSnapshotFile(url string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(url)))
+}
+
+// indexTwts adds twts to the indexes. The caller must hold cache.mu.
+func (cache *Cache) indexTwts(twts types.Twts) {
+	if cache.hashes == nil {
+		cache.hashes = make(hashIndex)
+	}
+	if cache.tags == nil {
+		cache.tags = make(twtIndex)
+	}
+	if cache.subjects == nil {
+		cache.subjects = make(twtIndex)
+	}
+	if cache.mentions == nil {
+		cache.mentions = make(twtIndex)
+	}
+	if cache.terms == nil {
+		cache.terms = make(twtIndex)
+	}
+
+	for _, twt := range twts {
+		if n := cache.hashes.add(twt); n > 0 {
+			log.Warnf(
+				"hash collision: twt %s by %s collides with %d other twt(s)",
+				twt.Hash(), twt.Twter().URL, n,
+			)
+		}
+		for _, tag := range twt.Tags() {
+			cache.tags.add(tag.Tag(), twt)
+		}
+		cache.subjects.add(subjectKey(twt.Subject()), twt)
+		for _, mention := range twt.Mentions() {
+			if url := NormalizeURL(mention.Twter().URL); url != "" {
+				cache.mentions.add(url, twt)
+			}
+		}
+		for _, key := range twtSearchKeys(twt) {
+			cache.terms.add(key, twt)
+		}
+	}
+}
+
+// unindexTwts removes twts from the indexes. The caller must hold cache.mu.
+func (cache *Cache) unindexTwts(twts types.Twts) {
+	for _, twt := range twts {
+		cache.hashes.remove(twt)
+		for _, tag := range twt.Tags() {
+			cache.tags.remove(tag.Tag(), twt)
+		}
+		cache.subjects.remove(subjectKey(twt.Subject()), twt)
+		for _, mention := range twt.Mentions() {
+			if url := NormalizeURL(mention.Twter().URL); url != "" {
+				cache.mentions.remove(url, twt)
+			}
+		}
+		for _, key := range twtSearchKeys(twt) {
+			cache.terms.remove(key, twt)
+		}
+	}
+}
+
+// indexArchived records archived twts by subject and search key. The
+// caller must hold cache.mu.
+func (cache *Cache) indexArchived(twts types.Twts) {
+	if cache.Archived == nil {
+		cache.Archived = make(map[string]map[string]bool)
+	}
+	if cache.ArchivedTerms == nil {
+		cache.ArchivedTerms = make(map[string]map[string]bool)
+	}
+
+	add := func(idx map[string]map[string]bool, key, hash string) {
+		hashes, ok := idx[key]
+		if !ok {
+			hashes = make(map[string]bool)
+			idx[key] = hashes
+		}
+		if !hashes[hash] {
+			hashes[hash] = true
+			cache.snapshotDirty = true
+		}
+	}
+
+	for _, twt := range twts {
+		add(cache.Archived, subjectKey(twt.Subject()), twt.Hash())
+		for _, key := range twtSearchKeys(twt) {
+			add(cache.ArchivedTerms, key, twt.Hash())
+		}
+	}
+}
+
+// unindexArchived removes an archived twt from the subject and search key
+// indexes. The caller must hold cache.mu.
+func (cache *Cache) unindexArchived(twt types.Twt) {
+	del := func(idx map[string]map[string]bool, key, hash string) {
+		hashes, ok := idx[key]
+		if !ok || !hashes[hash] {
+			return
+		}
+		delete(hashes, hash)
+		if len(hashes) == 0 {
+			delete(idx, key)
+		}
+		cache.snapshotDirty = true
+	}
+
+	del(cache.Archived, subjectKey(twt.Subject()), twt.Hash())
+	for _, key := range twtSearchKeys(twt) {
+		del(cache.ArchivedTerms, key, twt.Hash())
+	}
+}
+
+// UpdateArchived replaces the archived twt old with twt in the archive, its
+// indexes and the history of its feed after it was edited in its feed or
+// removes it if twt is nil after it was deleted. Twts that were never archived
+// are left alone, FetchTwts() picks up the change to their feed.
+func (cache *Cache) UpdateArchived(archive Archiver, old, twt types.Twt) {
+	if !archive.Has(old.Hash()) {
+		return
+	}
+
+	candidates, err := archive.GetAll(old.Hash())
+	if err != nil || !hasTwt(candidates, old) {
+		return
+	}
+
+	if err := archive.Del(old.Hash()); err != nil {
+		log.WithError(err).Errorf("error deleting archived twt %s", old.Hash())
+		return
+	}
+
+	// Deleting old deletes the twts whose hashes collide with it too
+	var others types.Twts
+	for _, candidate := range candidates {
+		if !sameTwt(candidate, old) {
+			others = append(others, candidate)
+		}
+	}
+	others = cache.archiveTwts(archive, others)
+
+	var archived types.Twts
+	if twt != nil && !twt.IsZero() {
+		archived = cache.archiveTwts(archive, types.Twts{twt})
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.unindexArchived(old)
+	cache.indexArchived(others)
+
+	history, ok := cache.History[old.Twter().URL]
+	if !ok {
+		return
+	}
+	if _, ok := history.Twts[twtKey(old)]; ok {
+		delete(history.Twts, twtKey(old))
+		if len(archived) > 0 {
+			history.Twts[twtKey(archived[0])] = archived[0].Hash()
+		}
+		cache.markStateDirty(old.Twter().URL)
+	}
+}
+
+// reindex rebuilds the indexes from scratch. The caller must hold cache.mu.
+func (cache *Cache) reindex() {
+	cache.hashes = make(hashIndex)
+	cache.tags = make(twtIndex)
+	cache.subjects = make(twtIndex)
+	cache.mentions = make(twtIndex)
+	cache.terms = make(twtIndex)
+	cache.timeline = nil
+	cache.views = nil
+	for url, cached := range cache.Twts {
+		cache.indexTwts(cached.Twts)
+		for _, twt := range cached.Twts {
+			cache.timeline = append(cache.timeline, timelineEntry{url: url, twt: twt})
+		}
+	}
+	sort.Slice(cache.timeline, func(i, j int) bool {
+		return twtBefore(cache.timeline[i].twt, cache.timeline[j].twt)
+	})
+}
+
+// setCached replaces the cached twts for the feed url and updates the
+// indexes incrementally. The caller must hold cache.mu.
+func (cache *Cache) setCached(url string, cached *Cached) {
+	var old types.Twts
+	if prev, ok := cache.Twts[url]; ok {
+		old = prev.Twts
+		cache.unindexTwts(old)
+	}
+	cache.Twts[url] = cached
+	cache.indexTwts(cached.Twts)
+	cache.timeline.update(url, old, cached.Twts)
+	cache.invalidateViews(url)
+	cache.markDirty(url)
+}
+
+// invalidateViews drops the views that cover the feed url. The caller must
+// hold cache.mu.
+func (cache *Cache) invalidateViews(url string) {
+	for prefix := range cache.views {
+		if strings.HasPrefix(url, prefix) {
+			delete(cache.views, prefix)
+		}
+	}
+}
+
+// markDirty marks the feed url as needing to be persisted by the next Store.
+// The caller must hold cache.mu.
+func (cache *Cache) markDirty(url string) {
+	if cache.dirty == nil {
+		cache.dirty = make(map[string]bool)
+	}
+	cache.dirty[url] = true
+}
+
+// markStateDirty marks the health and history of the feed url as needing to
+// be persisted by the next Store. The caller must hold cache.mu.
+func (cache *Cache) markStateDirty(url string) {
+	if cache.stateDirty == nil {
+		cache.stateDirty = make(map[string]bool)
+	}
+	cache.stateDirty[url] = true
+}
+
+// Store persists the cache to path. Only the feeds whose twts, health or
+// history have changed since the last Store are written, each to its own
+// snapshot in feedCacheDir or feedStateDir, so that a large pod does not
+// re-encode every feed on every update. All snapshots are written atomically
+// and checksummed (see writeSnapshot).
 func (cache *Cache) Store(path string) error {
-	b := new(bytes.Buffer)
-	enc := gob.NewEncoder(b)
-	err := enc.Encode(cache)
+	dir := filepath.Join(path, feedCacheDir)
+	stateDir := filepath.Join(path, feedStateDir)
+	for _, d := range []string{dir, stateDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			log.WithError(err).Error("error creating cache directory")
+			return err
+		}
+	}
 
-	if err != nil {
-		log.WithError(err).Error("error encoding cache")
-		return err
+	cache.mu.Lock()
+	feeds := make(map[string]*Cached, len(cache.dirty))
+	for url := range cache.dirty {
+		// nil if the feed has since been deleted
+		feeds[url] = cache.Twts[url]
 	}
+	cache.dirty = make(map[string]bool)
 
-	f, err := os.OpenFile(filepath.Join(path, feedCacheFile), os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		log.WithError(err).Error("error opening cache file for writing")
-		return err
+	states := make(map[string]*feedStateSnapshot, len(cache.stateDirty))
+	for url := range cache.stateDirty {
+		state := &feedStateSnapshot{URL: url, History: cache.History[url].copy()}
+		if health, ok := cache.Health[url]; ok {
+			h := *health
+			state.Health = &h
+		}
+		states[url] = state
 	}
+	cache.stateDirty = make(map[string]bool)
 
-	defer f.Close()
+	snapshotDirty := cache.snapshotDirty
+	cache.snapshotDirty = false
+	cache.mu.Unlock()
 
-	if _, err = f.Write(b.Bytes()); err != nil {
-		log.WithError(err).Error("error writing cache file")
-		return err
+	var lastErr error
+
+	if snapshotDirty {
+		// Only changes to the archived twt indexes wait on the encoding
+		b := new(bytes.Buffer)
+		cache.mu.RLock()
+		err := gob.NewEncoder(b).Encode(cacheSnapshot{
+			Version:       cache.Version,
+			Archived:      cache.Archived,
+			ArchivedTerms: cache.ArchivedTerms,
+		})
+		cache.mu.RUnlock()
+		if err == nil {
+			err = writeSnapshot(filepath.Join(path, feedCacheFile), b.Bytes())
+		}
+		if err != nil {
+			log.WithError(err).Error("error writing cache file")
+			cache.mu.Lock()
+			cache.snapshotDirty = true
+			cache.mu.Unlock()
+			lastErr = err
+		}
 	}
-	return nil
+
+	for url, cached := range feeds {
+		var snapshot interface{}
+		if cached != nil {
+			snapshot = feedSnapshot{URL: url, Cached: cached}
+		}
+		if err := storeSnapshot(filepath.Join(dir, feedSnapshotFile(url)), snapshot); err != nil {
+			log.WithError(err).Errorf("error writing cache file for %s", url)
+			cache.mu.Lock()
+			cache.markDirty(url)
+			cache.mu.Unlock()
+			lastErr = err
+		}
+	}
+
+	for url, state := range states {
+		var snapshot interface{}
+		if state.Health != nil || state.History != nil {
+			snapshot = state
+		}
+		if err := storeSnapshot(filepath.Join(stateDir, feedSnapshotFile(url)), snapshot); err != nil {
+			log.WithError(err).Errorf("error writing state file for %s", url)
+			cache.mu.Lock()
+			cache.markStateDirty(url)
+			cache.mu.Unlock()
+			lastErr = err
+		}
+	}
+
+	return lastErr
 }
 
-// LoadCache ...
-func LoadCache(path string) (*Cache, error) {
+// LoadCache loads the cache persisted by Store from path. Snapshots that are
+// corrupt (fail their checksum) or of an older version are discarded and the
+// affected feeds are simply fetched again. The indexes of archived twts are
+// rebuilt from archive if they were discarded (or never persisted). Local
+// feeds must be written through feedWriter to be read correctly by LoadFeed.
+func LoadCache(path string, archive Archiver, feedWriter *FeedWriter) (*Cache, error) {
 	cache := &Cache{
-		Twts: make(map[string]*Cached),
+		Version:    feedCacheVersion,
+		Twts:       make(map[string]*Cached),
+		Health:     make(map[string]*FeedHealth),
+		History:    make(map[string]*FeedHistory),
+		dirty:      make(map[string]bool),
+		stateDirty: make(map[string]bool),
+		feedWriter: feedWriter,
 	}
 
-	f, err := os.Open(filepath.Join(path, feedCacheFile))
+	dir := filepath.Join(path, feedCacheDir)
+	stateDir := filepath.Join(path, feedStateDir)
+
+	data, err := readSnapshot(filepath.Join(path, feedCacheFile))
 	if err != nil {
-		if !os.IsNotExist(err) {
+		if !os.IsNotExist(err) && err != ErrSnapshotCorrupt {
 			log.WithError(err).Error("error loading cache, cache file found but unreadable")
 			return nil, err
 		}
-		cache.Version = feedCacheVersion
-		return cache, nil
+		if err == ErrSnapshotCorrupt {
+			log.WithError(err).Error("error loading cache, ignoring corrupt or old cache file")
+		}
+		cache.snapshotDirty = true
+	} else {
+		var snapshot cacheSnapshot
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot); err != nil {
+			log.WithError(err).Error("error decoding cache, ignoring corrupt cache file")
+			cache.snapshotDirty = true
+		} else if snapshot.Version != feedCacheVersion {
+			log.Errorf("Cache version mismatch. Expect = %d, Got = %d. Removing old cache.", feedCacheVersion, snapshot.Version)
+			os.RemoveAll(dir)
+			os.RemoveAll(stateDir)
+			cache.snapshotDirty = true
+		} else {
+			cache.Archived = snapshot.Archived
+			cache.ArchivedTerms = snapshot.ArchivedTerms
+		}
 	}
-	defer f.Close()
 
-	dec := gob.NewDecoder(f)
-	err = dec.Decode(&cache)
+	err = loadSnapshots(dir, func(data []byte) error {
+		var snapshot feedSnapshot
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot); err != nil {
+			return err
+		}
+		if snapshot.Cached == nil {
+			return ErrSnapshotCorrupt
+		}
+		cache.Twts[snapshot.URL] = snapshot.Cached
+		return nil
+	})
 	if err != nil {
-		if strings.Contains(err.Error(), "wrong type") {
-			log.WithError(err).Error("error decoding cache. removing corrupt file.")
-			// Remove invalid cache file.
-			os.Remove(filepath.Join(path, feedCacheFile))
-			cache.Version = feedCacheVersion
-			cache.Twts = make(map[string]*Cached)
+		log.WithError(err).Error("error reading cache directory")
+		return nil, err
+	}
 
-			return cache, nil
+	err = loadSnapshots(stateDir, func(data []byte) error {
+		var snapshot feedStateSnapshot
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot); err != nil {
+			return err
+		}
+		if snapshot.Health != nil {
+			cache.Health[snapshot.URL] = snapshot.Health
 		}
+		if snapshot.History != nil {
+			cache.History[snapshot.URL] = snapshot.History
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("error reading state directory")
+		return nil, err
+	}
 
-		log.WithError(err).Error("error decoding cache (trying OldCache)")
+	log.Infof("Cache version %d (%d feeds)", cache.Version, len(cache.Twts))
 
-		_, _ = f.Seek(0, io.SeekStart)
-		oldcache := make(OldCache)
-		dec := gob.NewDecoder(f)
-		err = dec.Decode(&oldcache)
-		if err != nil {
-			log.WithError(err).Error("error decoding cache. removing corrupt file.")
-			// Remove invalid cache file.
-			os.Remove(filepath.Join(path, feedCacheFile))
-			cache.Version = feedCacheVersion
-			cache.Twts = make(map[string]*Cached)
+	cache.reindex()
 
-			return cache, nil
-		}
-		cache.Version = feedCacheVersion
-		for url, cached := range oldcache {
-			cache.Twts[url] = cached
-			cache.mu.Unlock()
+	if cache.Archived == nil || cache.ArchivedTerms == nil {
+		if err := cache.reindexArchived(archive); err != nil {
+			log.WithError(err).Error("error indexing archived twts")
+			return nil, err
 		}
 	}
 
-	log.Infof("Cache version %d", cache.Version)
-	if cache.Version != feedCacheVersion {
-		log.Errorf("Cache version mismatch. Expect = %d, Got = %d. Removing old cache.", feedCacheVersion, cache.Version)
-		os.Remove(filepath.Join(path, feedCacheFile))
-		cache.Version = feedCacheVersion
-		cache.Twts = make(map[string]*Cached)
+	return cache, nil
+}
+
+// reindexArchived rebuilds the indexes of archived twts (see indexArchived)
+// from scratch by walking every twt in archive. The indexes are derived from
+// the archive but only persisted with the cache snapshot, so they are lost
+// whenever it is.
+func (cache *Cache) reindexArchived(archive Archiver) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.Archived = make(map[string]map[string]bool)
+	cache.ArchivedTerms = make(map[string]map[string]bool)
+	cache.snapshotDirty = true
+
+	var n int
+	err := archive.Walk(func(twt types.Twt) error {
+		n++
+		cache.indexArchived(types.Twts{twt})
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return cache, nil
+	log.Infof("indexed %d archived twts", n)
+
+	return nil
 }
 
 const maxfetchers = 50
@@ -190,6 +695,16 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 				wg.Done()
 			}()
 
+			// Feeds of this pod are read straight from disk rather than
+			// fetched from ourselves over HTTP
+			if name, ok := localFeedName(conf, feed.URL); ok {
+				twtsch <- cache.LoadFeed(conf, archive, name)
+				return
+			}
+
+			// health is tracked against the url the feed is followed by
+			url := feed.URL
+
 			headers := make(http.Header)
 
 			if followers != nil {
@@ -227,17 +742,24 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 				}
 			}
 
+			var prev *Cached
+
 			cache.mu.RLock()
 			if cached, ok := cache.Twts[feed.URL]; ok {
+				prev = cached
 				if cached.Lastmodified != "" {
 					headers.Set("If-Modified-Since", cached.Lastmodified)
 				}
+				if cached.ETag != "" {
+					headers.Set("If-None-Match", cached.ETag)
+				}
 			}
 			cache.mu.RUnlock()
 
-			res, err := Request(conf, http.MethodGet, feed.URL, headers)
+			res, err := requestFeed(conf, feed.URL, headers, prev)
 			if err != nil {
 				log.WithError(err).Errorf("error fetching feed %s", feed)
+				cache.recordFetch(conf, url, 0, err)
 				twtsch <- nil
 				return
 			}
@@ -245,7 +767,13 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 
 			actualurl := res.Request.URL.String()
 			if actualurl != feed.URL {
-				log.WithError(err).Errorf("feed for %s changed from %s to %s", feed.Nick, feed.URL, actualurl)
+				if movedTo, ok := PermanentRedirect(res); ok {
+					log.Infof("feed for %s permanently moved from %s to %s", feed.Nick, feed.URL, movedTo)
+					cache.moveFeed(feed.URL, movedTo)
+					url = movedTo
+				} else {
+					log.Warnf("feed for %s changed from %s to %s", feed.Nick, feed.URL, actualurl)
+				}
 				feed.URL = actualurl
 			}
 
@@ -258,52 +786,105 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 			var twts types.Twts
 
 			switch res.StatusCode {
-			case http.StatusOK: // 200
+			case http.StatusOK, http.StatusPartialContent: // 200, 206
 				limitedReader := &io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit}
+				body := &tailRecorder{r: limitedReader}
+
+				// A partial response is what has been appended to prev
+				partial := res.StatusCode == http.StatusPartialContent
+				if partial && prev == nil {
+					log.Warnf("feed %s partially fetched but was never fetched in full", feed)
+					cache.recordFetch(conf, url, res.StatusCode, ErrUnexpectedPartialContent)
+					twtsch <- nil
+					return
+				}
+				if partial {
+					body.n = prev.Length
+					body.tail = append([]byte(nil), prev.Tail...)
+				}
+
+				var prevMeta *types.Metadata
+				if prev != nil {
+					prevMeta = prev.Metadata
+				}
+
+				external := !strings.HasPrefix(feed.URL, conf.BaseURL)
+
 				twter := types.Twter{Nick: feed.Nick}
-				if strings.HasPrefix(feed.URL, conf.BaseURL) {
+				if !external {
 					twter.URL = URLForUser(conf, feed.Nick)
 					twter.Avatar = URLForAvatar(conf, feed.Nick)
 				} else {
 					twter.URL = feed.URL
-					avatar := GetExternalAvatar(conf, feed.Nick, feed.URL)
+					avatar := GetExternalAvatar(conf, feed.Nick, feed.URL, prevMeta)
 					if avatar != "" {
 						twter.Avatar = URLForExternalAvatar(conf, feed.URL)
 					}
 				}
-				twts, old, err := types.ParseFile(limitedReader, twter, conf.MaxCacheTTL, conf.MaxCacheItems)
+				twts, old, meta, err := types.ParseFile(body, twter, conf.MaxCacheTTL, conf.MaxCacheItems)
 				if err != nil {
 					log.WithError(err).Errorf("error parsing feed %s", feed)
+					cache.recordFetch(conf, url, res.StatusCode, err)
 					twtsch <- nil
 					return
 				}
 
-				// Archive old twts
-				for _, twt := range old {
-					if !archive.Has(twt.Hash()) {
-						if err := archive.Archive(twt); err != nil {
-							log.WithError(err).Errorf("error archiving twt %s aborting", twt.Hash())
-							metrics.Counter("archive", "error").Inc()
-						} else {
-							metrics.Counter("archive", "size").Inc()
-						}
+				if partial {
+					var expired types.Twts
+					twts, expired = mergeTwts(prev.Twts, twts, conf.MaxCacheTTL, conf.MaxCacheItems)
+					old = append(old, expired...)
+
+					// Headers are at the top of the feed, not in what was appended
+					if meta.IsZero() {
+						meta = prevMeta
 					}
 				}
 
+				length := body.n
+				if limitedReader.N <= 0 {
+					length = 0
+				}
+
 				lastmodified := res.Header.Get("Last-Modified")
+				etag := res.Header.Get("ETag")
+
+				// Replace the avatar of an external feed when it declares a
+				// new one, twts already parsed without an avatar get it the
+				// next time the feed is fetched in full.
+				if external && meta != nil && meta.Avatar != "" && (prevMeta == nil || prevMeta.Avatar != meta.Avatar) {
+					if err := DownloadExternalAvatar(conf, feed.URL, meta.Avatar); err == nil && twter.Avatar == "" {
+						lastmodified, etag, length = "", "", 0
+					}
+				}
+
+				cache.archiveTwts(archive, old)
+
 				cache.mu.Lock()
-				cache.Twts[feed.URL] = &Cached{
+				cache.setCached(feed.URL, &Cached{
 					cache:        make(map[string]types.Twt),
 					Twts:         twts,
 					Lastmodified: lastmodified,
-				}
+					ETag:         etag,
+					Length:       length,
+					Tail:         body.tail,
+					Metadata:     meta,
+				})
 				cache.mu.Unlock()
 			case http.StatusNotModified: // 304
-				cache.mu.RLock()
-				twts = cache.Twts[feed.URL].Twts
-				cache.mu.RUnlock()
+				// Not modified since prev which was looked up by the url the
+				// feed was requested from, feed.URL may since be a redirect's
+				// (and a permanent one has already dropped it from the cache)
+				if prev == nil {
+					log.Warnf("feed %s not modified but was never fetched", feed)
+					cache.recordFetch(conf, url, res.StatusCode, ErrUnexpectedNotModified)
+					twtsch <- nil
+					return
+				}
+				twts = prev.Twts
 			}
 
+			cache.recordFetch(conf, url, res.StatusCode, nil)
+
 			twtsch <- twts
 		}(feed)
 	}
@@ -327,17 +908,17 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 	metrics.Gauge("cache", "twts").Set(float64(count))
 }
 
-// Lookup ...
+// Lookup returns the newest cached twt with the given hash. Hashes are short
+// so different twts may have the same hash, see LookupAll().
 func (cache *Cache) Lookup(hash string) (types.Twt, bool) {
 	cache.mu.RLock()
-	defer cache.mu.RUnlock()
-	for _, cached := range cache.Twts {
-		twt, ok := cached.Lookup(hash)
-		if ok {
-			return twt, true
-		}
+	twts := cache.hashes.get(hash)
+	cache.mu.RUnlock()
+
+	if len(twts) == 0 {
+		return types.NilTwt, false
 	}
-	return types.NilTwt, false
+	return twts[0], true
 }
 
 func (cache *Cache) Count() int {
@@ -361,54 +942,311 @@ func (cache *Cache) GetAll() types.Twts {
 	return alltwts
 }
 
-// GetMentions ...
-func (cache *Cache) GetMentions(u *User) (twts types.Twts) {
+// GetTimeline returns the twts (newest first) of the given feeds, filtered
+// from the cache's timeline, skipping the first offset of them and stopping
+// after limit twts unless limit is 0
+func (cache *Cache) GetTimeline(feeds types.Feeds, offset, limit int) types.Twts {
+	urls := make(map[string]bool, len(feeds))
+	for feed := range feeds {
+		urls[feed.URL] = true
+	}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	return cache.timeline.filter(func(url string) bool { return urls[url] }, offset, limit)
+}
+
+// CountTimeline returns the number of twts in the timeline of the given
+// feeds without filtering it
+func (cache *Cache) CountTimeline(feeds types.Feeds) int {
+	urls := make(map[string]bool, len(feeds))
+	for feed := range feeds {
+		urls[feed.URL] = true
+	}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	n := 0
+	for url := range urls {
+		if cached, ok := cache.Twts[url]; ok {
+			n += len(cached.Twts)
+		}
+	}
+	return n
+}
+
+// GetMentions returns the twts (newest first) that @mention the user or
+// any of the user's feeds
+func (cache *Cache) GetMentions(conf *Config, u *User) (twts types.Twts) {
+	urls := []string{u.URL}
+	for _, feed := range u.Feeds {
+		urls = append(urls, URLForUser(conf, feed))
+	}
+
 	seen := make(map[string]bool)
 
-	// Search for @mentions in the cache against all Twts (local, followed and even external if any)
-	for _, twt := range cache.GetAll() {
-		for _, mention := range twt.Mentions() {
-			if u.Is(mention.Twter().URL) && !seen[twt.Hash()] {
+	cache.mu.RLock()
+	for _, url := range urls {
+		for key, twt := range cache.mentions[NormalizeURL(url)] {
+			if !seen[key] {
 				twts = append(twts, twt)
-				seen[twt.Hash()] = true
+				seen[key] = true
 			}
 		}
 	}
+	cache.mu.RUnlock()
+
+	sort.Sort(twts)
 
 	return
 }
 
-// GetByPrefix ...
+// GetByPrefix returns the twts (newest first) of all feeds whose url starts
+// with prefix, such as the local timeline. The view is kept until a feed it
+// covers changes, refresh forces it to be rebuilt.
 func (cache *Cache) GetByPrefix(prefix string, refresh bool) types.Twts {
-	key := fmt.Sprintf("prefix:%s", prefix)
 	cache.mu.RLock()
-	cached, ok := cache.Twts[key]
+	twts, ok := cache.views[prefix]
 	cache.mu.RUnlock()
 	if ok && !refresh {
-		return cached.Twts
+		return twts
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	twts = cache.timeline.filter(func(url string) bool { return strings.HasPrefix(url, prefix) }, 0, 0)
+
+	if cache.views == nil {
+		cache.views = make(map[string]types.Twts)
 	}
+	cache.views[prefix] = twts
+
+	return twts
+}
 
-	var twts types.Twts
+// twtBefore reports whether a sorts before b in the order returned by
+// GetByTag (newest first, ties broken by hash so paging is stable)
+func twtBefore(a, b types.Twt) bool {
+	if a.Created().Equal(b.Created()) {
+		return a.Hash() < b.Hash()
+	}
+	return a.Created().After(b.Created())
+}
 
+// GetByTag returns up to limit twts tagged with tag (newest first) that
+// sort after the twt whose hash is cursor, along with the cursor for the
+// next page (empty if there are no more results).
+// An empty cursor starts at the beginning and a limit <= 0 returns all.
+func (cache *Cache) GetByTag(tag, cursor string, limit int) (types.Twts, string, error) {
 	cache.mu.RLock()
-	for url, cached := range cache.Twts {
-		if strings.HasPrefix(url, prefix) {
-			twts = append(twts, cached.Twts...)
+	tagged := cache.tags[tag]
+	twts := make(types.Twts, 0, len(tagged))
+	for _, twt := range tagged {
+		twts = append(twts, twt)
+	}
+	cache.mu.RUnlock()
+
+	return pageTwts(twts, cursor, limit)
+}
+
+// pageTwts sorts twts (see twtBefore) and returns up to limit of them that
+// sort after the twt whose hash is cursor along with the cursor for the next
+// page, see GetByTag()
+func pageTwts(twts types.Twts, cursor string, limit int) (types.Twts, string, error) {
+	sort.Slice(twts, func(i, j int) bool { return twtBefore(twts[i], twts[j]) })
+
+	if cursor != "" {
+		start := -1
+		for i, twt := range twts {
+			if twt.Hash() == cursor {
+				start = i + 1
+				break
+			}
+		}
+		if start == -1 {
+			return nil, "", ErrInvalidCursor
+		}
+		twts = twts[start:]
+	}
+
+	if limit <= 0 || len(twts) <= limit {
+		return twts, "", nil
+	}
+
+	twts = twts[:limit]
+	return twts, twts[len(twts)-1].Hash(), nil
+}
+
+// Search returns up to limit twts (newest first) matching query from both
+// the cache and the archive, paged by cursor like GetByTag()
+func (cache *Cache) Search(archive Archiver, query *SearchQuery, cursor string, limit int) (types.Twts, string, error) {
+	keys := query.keys()
+
+	var (
+		twts     types.Twts
+		archived []string
+	)
+
+	cache.mu.RLock()
+	// Start from the key with the fewest twts and check the others
+	live := cache.terms[keys[0]]
+	for _, key := range keys[1:] {
+		if len(cache.terms[key]) < len(live) {
+			live = cache.terms[key]
+		}
+	}
+	for k, twt := range live {
+		if hasAllKeys(cache.terms, keys, k) {
+			twts = append(twts, twt)
+		}
+	}
+
+	hashes := cache.ArchivedTerms[keys[0]]
+	for _, key := range keys[1:] {
+		if len(cache.ArchivedTerms[key]) < len(hashes) {
+			hashes = cache.ArchivedTerms[key]
+		}
+	}
+	for hash := range hashes {
+		if hasAllArchivedKeys(cache.ArchivedTerms, keys, hash) {
+			archived = append(archived, hash)
+		}
+	}
+	cache.mu.RUnlock()
+
+	found := make(map[string]bool, len(twts))
+	for _, twt := range twts {
+		found[twtKey(twt)] = true
+	}
+	for _, hash := range archived {
+		all, err := archive.GetAll(hash)
+		if err != nil {
+			log.WithError(err).Warnf("error loading archived twt %s", hash)
+			continue
+		}
+		for _, twt := range all {
+			if !twt.IsZero() && !found[twtKey(twt)] {
+				twts = append(twts, twt)
+			}
+		}
+	}
+
+	matches := make(types.Twts, 0, len(twts))
+	for _, twt := range twts {
+		if query.Match(twt) {
+			matches = append(matches, twt)
+		}
+	}
+
+	return pageTwts(matches, cursor, limit)
+}
+
+// hasAllKeys returns true if the twt (keyed by twtKey k) is indexed by all
+// of keys
+func hasAllKeys(idx twtIndex, keys []string, k string) bool {
+	for _, key := range keys {
+		if _, ok := idx[key][k]; !ok {
+			return false
 		}
 	}
+	return true
+}
+
+// hasAllArchivedKeys returns true if the archived twt hash is indexed by all
+// of keys
+func hasAllArchivedKeys(idx map[string]map[string]bool, keys []string, hash string) bool {
+	for _, key := range keys {
+		if !idx[key][hash] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetReplies returns the twts (newest first) whose subject refers to the
+// twt with the given hash, including the twt itself. Replies that have aged
+// out of the cache are retrieved from the archive.
+func (cache *Cache) GetReplies(archive Archiver, hash string) types.Twts {
+	var (
+		twts     types.Twts
+		archived []string
+	)
+
+	cache.mu.RLock()
+	live := cache.subjects[hash]
+	for _, twt := range live {
+		twts = append(twts, twt)
+	}
+	for h := range cache.Archived[hash] {
+		archived = append(archived, h)
+	}
 	cache.mu.RUnlock()
 
+	for _, h := range archived {
+		all, err := archive.GetAll(h)
+		if err != nil {
+			log.WithError(err).Warnf("error loading archived reply %s", h)
+			continue
+		}
+		// Other twts whose hashes collide with the reply's are not replies
+		for _, twt := range all {
+			if twt.IsZero() || subjectKey(twt.Subject()) != hash {
+				continue
+			}
+			if _, ok := live[twtKey(twt)]; !ok {
+				twts = append(twts, twt)
+			}
+		}
+	}
+
 	sort.Sort(twts)
 
+	return twts
+}
+
+// moveFeed drops the cached twts and health of the feed at url from which
+// has permanently moved to the url to and records the move to be applied
+// to the Store, see FeedMoves()
+func (cache *Cache) moveFeed(from, to string) {
 	cache.mu.Lock()
-	cache.Twts[key] = &Cached{
-		cache:        make(map[string]types.Twt),
-		Twts:         twts,
-		Lastmodified: time.Now().Format(time.RFC3339),
+	defer cache.mu.Unlock()
+
+	if cached, ok := cache.Twts[from]; ok {
+		cache.unindexTwts(cached.Twts)
+		cache.timeline.update(from, cached.Twts, nil)
+		cache.invalidateViews(from)
+		delete(cache.Twts, from)
+		cache.markDirty(from)
 	}
-	cache.mu.Unlock()
 
-	return twts
+	if _, ok := cache.Health[from]; ok {
+		delete(cache.Health, from)
+		cache.markStateDirty(from)
+	}
+
+	if _, ok := cache.History[from]; ok {
+		delete(cache.History, from)
+		cache.markStateDirty(from)
+	}
+
+	if cache.moves == nil {
+		cache.moves = make(map[string]string)
+	}
+	cache.moves[from] = to
+}
+
+// FeedMoves returns (and forgets) the feeds that have permanently moved
+// since the last call as a map of old url to new url
+func (cache *Cache) FeedMoves() map[string]string {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	moves := cache.moves
+	cache.moves = nil
+	return moves
 }
 
 // IsCached ...
@@ -429,10 +1267,27 @@ func (cache *Cache) GetByURL(url string) types.Twts {
 	return types.Twts{}
 }
 
+// GetMetadata returns the metadata declared by the feed at url or nil if the
+// feed is not cached or declared none
+func (cache *Cache) GetMetadata(url string) *types.Metadata {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	if cached, ok := cache.Twts[url]; ok {
+		return cached.Metadata
+	}
+	return nil
+}
+
 // Delete ...
 func (cache *Cache) Delete(feeds types.Feeds) {
 	for feed := range feeds {
 		cache.mu.Lock()
+		if cached, ok := cache.Twts[feed.URL]; ok {
+			cache.unindexTwts(cached.Twts)
+			cache.timeline.update(feed.URL, cached.Twts, nil)
+			cache.invalidateViews(feed.URL)
+			cache.markDirty(feed.URL)
+		}
 		delete(cache.Twts, feed.URL)
 		cache.mu.Unlock()
 	}
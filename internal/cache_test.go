@@ -0,0 +1,525 @@
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+type testTag string
+
+func (tag testTag) Tag() string { return string(tag) }
+
+type testMention string
+
+func (mention testMention) Twter() types.Twter { return types.Twter{URL: string(mention)} }
+
+// testTwt is a minimal types.Twt for exercising the cache's indexes
+type testTwt struct {
+	hash     string
+	twter    types.Twter
+	created  time.Time
+	subject  string
+	tags     []string
+	mentions []string
+}
+
+func (twt *testTwt) Twter() types.Twter       { return twt.twter }
+func (twt *testTwt) Text() string             { return "" }
+func (twt *testTwt) SetFmtOpts(types.FmtOpts) {}
+func (twt *testTwt) MarkdownText() string     { return "" }
+func (twt *testTwt) Created() time.Time       { return twt.created }
+func (twt *testTwt) IsZero() bool             { return twt.hash == "" }
+func (twt *testTwt) Hash() string             { return twt.hash }
+func (twt *testTwt) Subject() string {
+	if twt.subject == "" {
+		return "(#" + twt.hash + ")"
+	}
+	return twt.subject
+}
+func (twt *testTwt) Mentions() types.MentionList {
+	var mentions types.MentionList
+	for _, mention := range twt.mentions {
+		mentions = append(mentions, testMention(mention))
+	}
+	return mentions
+}
+func (twt *testTwt) String() string { return twt.hash }
+func (twt *testTwt) Tags() types.TagList {
+	var tags types.TagList
+	for _, tag := range twt.tags {
+		tags = append(tags, testTag(tag))
+	}
+	return tags
+}
+
+func newTestTwt(hash string, created time.Time, tags ...string) types.Twt {
+	return &testTwt{hash: hash, created: created, tags: tags}
+}
+
+func newTestReply(hash string, created time.Time, subject string) types.Twt {
+	return &testTwt{hash: hash, created: created, subject: subject}
+}
+
+// testArchiver is an in-memory Archiver of the twts archived by hash
+type testArchiver map[string]types.Twts
+
+func (a testArchiver) Del(hash string) error { delete(a, hash); return nil }
+func (a testArchiver) Has(hash string) bool  { _, ok := a[hash]; return ok }
+func (a testArchiver) Get(hash string) (types.Twt, error) {
+	twts, ok := a[hash]
+	if !ok {
+		return types.NilTwt, ErrTwtNotArchived
+	}
+	return twts[0], nil
+}
+func (a testArchiver) GetAll(hash string) (types.Twts, error) {
+	twts, ok := a[hash]
+	if !ok {
+		return nil, ErrTwtNotArchived
+	}
+	return twts, nil
+}
+func (a testArchiver) Archive(twt types.Twt) error {
+	if hasTwt(a[twt.Hash()], twt) {
+		return ErrTwtAlreadyArchived
+	}
+	a[twt.Hash()] = append(a[twt.Hash()], twt)
+	return nil
+}
+func (a testArchiver) Count() (int, error) {
+	var count int
+	for _, twts := range a {
+		count += len(twts)
+	}
+	return count, nil
+}
+func (a testArchiver) Walk(fn func(types.Twt) error) error {
+	for _, twts := range a {
+		for _, twt := range twts {
+			if err := fn(twt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hashes(twts types.Twts) (res []string) {
+	for _, twt := range twts {
+		res = append(res, twt.Hash())
+	}
+	return
+}
+
+func TestCache_GetByTag(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	cache := &Cache{Twts: make(map[string]*Cached)}
+
+	cache.setCached("http://a/twtxt.txt", &Cached{Twts: types.Twts{
+		newTestTwt("a1", now.Add(-3*time.Hour), "go"),
+		newTestTwt("a2", now.Add(-1*time.Hour), "go", "twtxt"),
+	}})
+	cache.setCached("http://b/twtxt.txt", &Cached{Twts: types.Twts{
+		newTestTwt("b1", now.Add(-2*time.Hour), "go"),
+		newTestTwt("b2", now, "twtxt"),
+	}})
+
+	twts, cursor, err := cache.GetByTag("go", "", 2)
+	assert.NoError(err)
+	assert.Equal([]string{"a2", "b1"}, hashes(twts))
+	assert.Equal("b1", cursor)
+
+	twts, cursor, err = cache.GetByTag("go", cursor, 2)
+	assert.NoError(err)
+	assert.Equal([]string{"a1"}, hashes(twts))
+	assert.Equal("", cursor)
+
+	_, _, err = cache.GetByTag("go", "b2", 2)
+	assert.Equal(ErrInvalidCursor, err)
+
+	// Refreshing a feed replaces its twts in the index
+	cache.setCached("http://a/twtxt.txt", &Cached{Twts: types.Twts{
+		newTestTwt("a3", now.Add(time.Hour), "twtxt"),
+	}})
+
+	twts, _, err = cache.GetByTag("go", "", 0)
+	assert.NoError(err)
+	assert.Equal([]string{"b1"}, hashes(twts))
+
+	twts, _, err = cache.GetByTag("twtxt", "", 0)
+	assert.NoError(err)
+	assert.Equal([]string{"a3", "b2"}, hashes(twts))
+
+	cache.Delete(types.Feeds{types.Feed{URL: "http://b/twtxt.txt"}: true})
+
+	twts, _, err = cache.GetByTag("go", "", 0)
+	assert.NoError(err)
+	assert.Empty(twts)
+}
+
+func TestCache_GetReplies(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	archive := make(testArchiver)
+
+	root := newTestTwt("root", now.Add(-3*time.Hour))
+	first := newTestReply("first", now.Add(-2*time.Hour), "(#root)")
+	second := newTestReply("second", now.Add(-1*time.Hour), "(#root)")
+	other := newTestReply("other", now, "(#elsewhere)")
+
+	cache.setCached("http://a/twtxt.txt", &Cached{Twts: types.Twts{root, first}})
+	cache.setCached("http://b/twtxt.txt", &Cached{Twts: types.Twts{second, other}})
+
+	assert.Equal([]string{"second", "first", "root"}, hashes(cache.GetReplies(archive, "root")))
+
+	// The root and first reply age out of the cache into the archive
+	assert.NoError(archive.Archive(root))
+	assert.NoError(archive.Archive(first))
+	cache.indexArchived(types.Twts{root, first})
+	cache.setCached("http://a/twtxt.txt", &Cached{})
+
+	assert.Equal([]string{"second", "first", "root"}, hashes(cache.GetReplies(archive, "root")))
+	assert.Equal([]string{"other"}, hashes(cache.GetReplies(archive, "elsewhere")))
+}
+
+func TestCache_GetMentions(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &Config{BaseURL: "http://0.0.0.0:8000"}
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = URLForUser(conf, "alice")
+	user.Feeds = []string{"news"}
+
+	now := time.Now()
+	cache := &Cache{Twts: make(map[string]*Cached)}
+
+	cache.setCached("http://b/twtxt.txt", &Cached{Twts: types.Twts{
+		&testTwt{hash: "a", created: now.Add(-2 * time.Hour), mentions: []string{"http://0.0.0.0:8000/user/alice/twtxt.txt"}},
+		&testTwt{hash: "b", created: now.Add(-1 * time.Hour), mentions: []string{"http://0.0.0.0:8000/user/news/twtxt.txt/"}},
+		&testTwt{hash: "c", created: now, mentions: []string{"http://0.0.0.0:8000/user/bob/twtxt.txt"}},
+	}})
+
+	assert.Equal([]string{"b", "a"}, hashes(cache.GetMentions(conf, user)))
+}
+
+func TestCache_GetTimeline(t *testing.T) {
+	assert := assert.New(t)
+
+	a := types.Feed{Nick: "a", URL: "http://a/twtxt.txt"}
+	b := types.Feed{Nick: "b", URL: "http://b/twtxt.txt"}
+	c := types.Feed{Nick: "c", URL: "http://c/twtxt.txt"}
+	feeds := types.Feeds{a: true, b: true}
+
+	now := time.Now()
+	cache := &Cache{Twts: make(map[string]*Cached)}
+
+	cache.setCached(a.URL, &Cached{Twts: types.Twts{
+		newTestTwt("a2", now.Add(-1*time.Hour)),
+		newTestTwt("a1", now.Add(-3*time.Hour)),
+	}})
+	cache.setCached(b.URL, &Cached{Twts: types.Twts{
+		newTestTwt("b1", now.Add(-2*time.Hour)),
+	}})
+	cache.setCached(c.URL, &Cached{Twts: types.Twts{
+		newTestTwt("c1", now),
+	}})
+
+	assert.Equal([]string{"a2", "b1", "a1"}, hashes(cache.GetTimeline(feeds, 0, 0)))
+
+	// Only what changed is updated
+	cache.setCached(a.URL, &Cached{Twts: types.Twts{
+		newTestTwt("a3", now.Add(-30*time.Minute)),
+		newTestTwt("a2", now.Add(-1*time.Hour)),
+	}})
+	assert.Equal([]string{"a3", "a2", "b1"}, hashes(cache.GetTimeline(feeds, 0, 0)))
+
+	// Only the requested page is filtered
+	assert.Equal([]string{"a2"}, hashes(cache.GetTimeline(feeds, 1, 1)))
+	assert.Equal([]string{"a2", "b1"}, hashes(cache.GetTimeline(feeds, 1, 5)))
+	assert.Empty(cache.GetTimeline(feeds, 3, 1))
+	assert.Equal(3, cache.CountTimeline(feeds))
+
+	// A batch of twts is merged in between those of other feeds
+	cache.setCached(b.URL, &Cached{Twts: types.Twts{
+		newTestTwt("b3", now.Add(-15*time.Minute)),
+		newTestTwt("b2", now.Add(-45*time.Minute)),
+		newTestTwt("b1", now.Add(-2*time.Hour)),
+		newTestTwt("b0", now.Add(-4*time.Hour)),
+	}})
+	assert.Equal([]string{"b3", "a3", "b2", "a2", "b1", "b0"}, hashes(cache.GetTimeline(feeds, 0, 0)))
+	assert.Equal(6, cache.CountTimeline(feeds))
+
+	cache.Delete(types.Feeds{b: true})
+	assert.Equal([]string{"a3", "a2"}, hashes(cache.GetTimeline(feeds, 0, 0)))
+
+	cache.moveFeed(c.URL, "http://d/twtxt.txt")
+	assert.Empty(cache.GetTimeline(types.Feeds{c: true}, 0, 0))
+
+	// The timeline is rebuilt from scratch the same
+	before := hashes(cache.GetTimeline(types.Feeds{a: true, c: true}, 0, 0))
+	cache.reindex()
+	assert.Equal(before, hashes(cache.GetTimeline(types.Feeds{a: true, c: true}, 0, 0)))
+}
+
+func TestCache_GetByPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	cache := &Cache{Twts: make(map[string]*Cached)}
+
+	cache.setCached("http://local/user/alice/twtxt.txt", &Cached{Twts: types.Twts{
+		newTestTwt("a1", now.Add(-2*time.Hour)),
+	}})
+	cache.setCached("http://local/user/bob/twtxt.txt", &Cached{Twts: types.Twts{
+		newTestTwt("b1", now.Add(-1*time.Hour)),
+	}})
+	cache.setCached("http://remote/twtxt.txt", &Cached{Twts: types.Twts{
+		newTestTwt("c1", now),
+	}})
+
+	assert.Equal([]string{"b1", "a1"}, hashes(cache.GetByPrefix("http://local/", false)))
+
+	// Views are not feeds
+	assert.Equal(3, cache.Count())
+	assert.Len(cache.GetAll(), 3)
+
+	// Views are rebuilt when a feed they cover changes
+	cache.setCached("http://local/user/alice/twtxt.txt", &Cached{Twts: types.Twts{
+		newTestTwt("a2", now.Add(-30*time.Minute)),
+		newTestTwt("a1", now.Add(-2*time.Hour)),
+	}})
+	assert.Equal([]string{"a2", "b1", "a1"}, hashes(cache.GetByPrefix("http://local/", false)))
+}
+
+func TestCache_Store(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := ioutil.TempDir("", "twtxt-cache")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(data)
+
+	archive := make(testArchiver)
+
+	cache, err := LoadCache(data, archive, NewFeedWriter())
+	if !assert.NoError(err) {
+		return
+	}
+
+	cache.mu.Lock()
+	cache.setCached("http://a/twtxt.txt", &Cached{Lastmodified: "a"})
+	cache.setCached("http://b/twtxt.txt", &Cached{Lastmodified: "b"})
+	cache.mu.Unlock()
+	assert.NoError(cache.Store(data))
+	assert.Empty(cache.dirty)
+
+	cache, err = LoadCache(data, archive, NewFeedWriter())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("a", cache.Twts["http://a/twtxt.txt"].Lastmodified)
+	assert.Equal("b", cache.Twts["http://b/twtxt.txt"].Lastmodified)
+
+	// Deleted feeds are removed on the next Store
+	cache.Delete(types.Feeds{types.Feed{URL: "http://b/twtxt.txt"}: true})
+	assert.NoError(cache.Store(data))
+	_, err = os.Stat(filepath.Join(data, feedCacheDir, feedSnapshotFile("http://b/twtxt.txt")))
+	assert.True(os.IsNotExist(err))
+
+	// A corrupt feed snapshot is discarded
+	fn := filepath.Join(data, feedCacheDir, feedSnapshotFile("http://a/twtxt.txt"))
+	assert.NoError(ioutil.WriteFile(fn, []byte("garbage"), 0644))
+	cache, err = LoadCache(data, archive, NewFeedWriter())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Empty(cache.Twts)
+
+	// The indexes of archived twts are rebuilt when the snapshot is lost
+	assert.NoError(archive.Archive(newTestReply("c", time.Now(), "(#a)")))
+	assert.NoError(os.Remove(filepath.Join(data, feedCacheFile)))
+	cache, err = LoadCache(data, archive, NewFeedWriter())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.True(cache.Archived["a"]["c"])
+	assert.NotNil(cache.ArchivedTerms)
+
+	assert.NoError(cache.Store(data))
+	cache, err = LoadCache(data, make(testArchiver), NewFeedWriter())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.True(cache.Archived["a"]["c"])
+
+	// Health and history are persisted per feed
+	conf := NewConfig()
+	cache.recordFetch(conf, "http://a/twtxt.txt", http.StatusNotFound, nil)
+	cache.mu.Lock()
+	cache.History["http://a/twtxt.txt"] = &FeedHistory{Twts: map[string]string{"c": "c"}}
+	cache.markStateDirty("http://a/twtxt.txt")
+	cache.mu.Unlock()
+	assert.NoError(cache.Store(data))
+	assert.Empty(cache.stateDirty)
+	assert.False(cache.snapshotDirty)
+
+	cache, err = LoadCache(data, archive, NewFeedWriter())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(1, cache.GetHealth("http://a/twtxt.txt").Failures)
+	assert.Equal(map[string]string{"c": "c"}, cache.History["http://a/twtxt.txt"].Twts)
+
+	// and removed once the feed has moved
+	cache.moveFeed("http://a/twtxt.txt", "http://b/twtxt.txt")
+	assert.NoError(cache.Store(data))
+	_, err = os.Stat(filepath.Join(data, feedStateDir, feedSnapshotFile("http://a/twtxt.txt")))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestCache_FeedHealth(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := NewConfig()
+	url := "http://a/twtxt.txt"
+	cache := &Cache{Twts: make(map[string]*Cached)}
+
+	assert.Nil(cache.GetHealth(url))
+	assert.True(cache.isDue(url))
+
+	cache.recordFetch(conf, url, http.StatusNotFound, nil)
+	cache.recordFetch(conf, url, 0, errors.New("connection refused"))
+
+	health := cache.GetHealth(url)
+	assert.True(health.Failing())
+	assert.False(health.Dead())
+	assert.Equal(2, health.Failures)
+	assert.Equal("connection refused", health.LastError)
+	assert.Equal(2*feedBackoffMin, health.NextAttempt.Sub(health.LastAttempt))
+	assert.False(cache.isDue(url))
+
+	cache.Health[url].FailingSince = time.Now().Add(-feedDeadAfter)
+	assert.True(cache.GetHealth(url).Dead())
+
+	cache.recordFetch(conf, url, http.StatusNotModified, nil)
+	health = cache.GetHealth(url)
+	assert.False(health.Failing())
+	assert.False(health.Dead())
+	assert.Equal(conf.MaxFetchInterval, health.NextAttempt.Sub(health.LastAttempt))
+	assert.False(cache.isDue(url))
+	assert.True(cache.stateDirty[url])
+
+	// Fetching a feed the same way again does not need it persisted again
+	cache.stateDirty = nil
+	cache.recordFetch(conf, url, http.StatusNotModified, nil)
+	assert.Empty(cache.stateDirty)
+
+	assert.Equal(feedBackoffMax, feedBackoff(100))
+}
+
+func TestPollInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := NewConfig()
+	now := time.Now()
+
+	assert.Equal(conf.MaxFetchInterval, pollInterval(conf, nil))
+
+	// Posting every hour, polled every 15 minutes
+	active := types.Twts{
+		newTestTwt("c", now.Add(-10*time.Minute)),
+		newTestTwt("b", now.Add(-70*time.Minute)),
+		newTestTwt("a", now.Add(-130*time.Minute)),
+	}
+	assert.Equal(15*time.Minute, pollInterval(conf, active))
+
+	// Posting every minute, polled no more than MinFetchInterval
+	busy := types.Twts{
+		newTestTwt("b", now),
+		newTestTwt("a", now.Add(-time.Minute)),
+	}
+	assert.Equal(conf.MinFetchInterval, pollInterval(conf, busy))
+
+	// Quiet for a month, polled no less than MaxFetchInterval
+	quiet := types.Twts{newTestTwt("a", now.Add(-30*24*time.Hour))}
+	assert.Equal(conf.MaxFetchInterval, pollInterval(conf, quiet))
+}
+
+func TestCache_FetchTwtsNotModifiedAfterRedirect(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old/twtxt.txt":
+			http.Redirect(w, r, "/new/twtxt.txt", http.StatusFound)
+		case "/moved/twtxt.txt":
+			http.Redirect(w, r, "/new/twtxt.txt", http.StatusMovedPermanently)
+		default:
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer server.Close()
+
+	conf := NewConfig()
+	conf.BaseURL = "http://0.0.0.0:8000"
+	archive := make(testArchiver)
+
+	// health is tracked against the url a feed has permanently moved to
+	fetch := func(url, healthURL string) {
+		cache := &Cache{Twts: make(map[string]*Cached)}
+		feed := types.Feed{Nick: "alice", URL: url}
+
+		// Never fetched so not modified since nothing
+		cache.FetchTwts(conf, archive, types.Feeds{feed: true}, nil)
+		assert.True(cache.GetHealth(healthURL).Failing(), url)
+
+		twts := types.Twts{newTestTwt("a", time.Now())}
+		cache.Twts[url] = &Cached{Twts: twts, ETag: `"a"`}
+		cache.Health = nil
+		cache.FetchTwts(conf, archive, types.Feeds{feed: true}, nil)
+		assert.False(cache.GetHealth(healthURL).Failing(), url)
+	}
+
+	fetch(server.URL+"/old/twtxt.txt", server.URL+"/old/twtxt.txt")
+	fetch(server.URL+"/moved/twtxt.txt", server.URL+"/new/twtxt.txt")
+}
+
+func TestCache_FetchTwtsUnexpectedPartialContent(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", "bytes 100-135/136")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte("2020-12-01T00:00:00Z\tHello World!\n"))
+	}))
+	defer server.Close()
+
+	conf := NewConfig()
+	conf.BaseURL = "http://0.0.0.0:8000"
+	conf.MaxFetchLimit = DefaultMaxFetchLimit
+
+	url := server.URL + "/twtxt.txt"
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	cache.FetchTwts(conf, make(testArchiver), types.Feeds{types.Feed{Nick: "alice", URL: url}: true}, nil)
+
+	assert.True(cache.GetHealth(url).Failing())
+	assert.Equal(ErrUnexpectedPartialContent.Error(), cache.GetHealth(url).LastError)
+	assert.Empty(cache.Twts)
+}
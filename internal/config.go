@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -67,7 +68,14 @@ type Config struct {
 	SMTPPass string
 	SMTPFrom string
 
-	MaxFetchLimit int64
+	MaxFetchLimit    int64
+	MinFetchInterval time.Duration
+	MaxFetchInterval time.Duration
+
+	FeedRotateAge  time.Duration
+	FeedRotateSize int64
+
+	FeedMoveNotices bool
 
 	APISessionTime time.Duration
 	APISigningKey  string
@@ -128,6 +136,30 @@ func (c *Config) RandomTwtPrompt() string {
 	return c.TwtPrompts[n]
 }
 
+// LoadConfig returns a new configuration with the given options applied and
+// any pod settings from the data directory merged in
+func LoadConfig(options ...Option) (*Config, error) {
+	config := NewConfig()
+
+	for _, opt := range options {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+
+	settings, err := LoadSettings(filepath.Join(config.Data, "settings.yaml"))
+	if err != nil {
+		log.Warnf("error loading pod settings: %s", err)
+	} else {
+		if err := merger.MergeOverwrite(config, settings); err != nil {
+			log.WithError(err).Error("error merging pod settings")
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
 // LoadSettings loads pod settings from the given path
 func LoadSettings(path string) (*Settings, error) {
 	var settings Settings
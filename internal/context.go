@@ -46,7 +46,6 @@ type Context struct {
 	Username      string
 	User          *User
 	Tokens        []*Token
-	LastTwt       types.Twt
 	Profile       types.Profile
 	Authenticated bool
 	IsAdmin       bool
@@ -70,8 +69,21 @@ type Context struct {
 	BlogPosts   BlogPosts
 	Feeds       []*Feed
 	FeedSources FeedSourceMap
+	FeedHealth  map[string]*FeedHealth
 	Pager       *paginator.Paginator
 
+	// Search
+	SearchQuery string
+
+	// Disambiguate is the path of the page linking to one of several twts
+	// whose hashes collide
+	Disambiguate string
+
+	// Lint
+	LintURL    string
+	LintFeed   string
+	LintReport *types.LintReport
+
 	// Report abuse
 	ReportNick string
 	ReportURL  string
@@ -92,7 +104,6 @@ func NewContext(conf *Config, db Store, req *http.Request) *Context {
 		MaxTwtLength:     conf.MaxTwtLength,
 		RegisterDisabled: !conf.OpenRegistrations,
 		OpenProfiles:     conf.OpenProfiles,
-		LastTwt:          types.NilTwt,
 
 		Commit: twtxt.Commit,
 		Theme:  conf.Theme,
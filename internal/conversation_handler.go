@@ -29,29 +29,13 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 			return
 		}
 
-		var err error
-
-		twt, ok := s.cache.Lookup(hash)
+		twt, ok := s.lookupTwt(w, r, ctx, hash)
 		if !ok {
-			// If the twt is not in the cache look for it in the archive
-			if s.archive.Has(hash) {
-				twt, err = s.archive.Get(hash)
-				if err != nil {
-					ctx.Error = true
-					ctx.Message = "Error loading twt from archive, please try again"
-					s.render("error", w, ctx)
-					return
-				}
-			}
-		}
-
-		if twt.IsZero() {
-			ctx.Error = true
-			ctx.Message = "No matching twt found!"
-			s.render("404", w, ctx)
 			return
 		}
 
+		var err error
+
 		var (
 			who   string
 			image string
@@ -94,16 +78,13 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 
 		getTweetsByHash := func(hash string, replyTo types.Twt) types.Twts {
 			var result types.Twts
-			seen := make(map[string]bool)
-			// TODO: Improve this by making this an O(1) lookup on the tag
-			for _, twt := range s.cache.GetAll() {
-				var tags types.TagList = twt.Tags()
-				if HasString(UniqStrings(tags.Tags()), hash) && !seen[twt.Hash()] {
+			for _, twt := range s.cache.GetReplies(s.archive, hash) {
+				// Leave out other twts whose hashes collide with replyTo
+				if twt.Hash() != replyTo.Hash() || sameTwt(twt, replyTo) {
 					result = append(result, twt)
-					seen[twt.Hash()] = true
 				}
 			}
-			if !seen[replyTo.Hash()] {
+			if !hasTwt(result, replyTo) {
 				result = append(result, replyTo)
 			}
 			return result
@@ -162,18 +143,6 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 			}...)
 		}
 
-		if ctx.Authenticated {
-			lastTwt, _, err := GetLastTwt(s.config, ctx.User)
-			if err != nil {
-				log.WithError(err).Error("error getting user last twt")
-				ctx.Error = true
-				ctx.Message = "An error occurred while loading the timeline"
-				s.render("error", w, ctx)
-				return
-			}
-			ctx.LastTwt = lastTwt
-		}
-
 		ctx.Reply = fmt.Sprintf("#%s", twt.Hash())
 		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
 		ctx.Pager = &pager
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+var (
+	// ErrFeedUnchanged is returned by the function passed to
+	// FeedWriter.Rewrite() to leave the feed as it is
+	ErrFeedUnchanged = errors.New("error: feed unchanged")
+)
+
+// FeedWriter writes local feed files (and their archive files, see
+// RotateFeed()) with a lock per file so that concurrent posts, edits, deletes
+// and rotations of a feed never interleave or lose lines. Appends are synced
+// to disk before returning and rewrites go to a temporary file that is synced
+// and renamed over the feed. Readers that open a feed with Open() therefore
+// only ever see the feed as it was before or after a write.
+type FeedWriter struct {
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
+
+	// Written (if set) is called with the name of each file written once
+	// the write is complete and the file unlocked again
+	Written func(fn string)
+
+	// hashes caches the hash of the content of each file, see Hash()
+	hashes map[string]fileHash
+}
+
+// fileHash is the hash of the content of a file as of fileInfo
+type fileHash struct {
+	fileInfo os.FileInfo
+	hash     string
+}
+
+// matches returns true if the file described by fileInfo is the same file,
+// with the same mtime and size, as the one hashed. Appends change a file's
+// size and rewrites replace it so the hash is never stale, even when a write
+// does not change the mtime (which has the granularity of a clock tick).
+func (h fileHash) matches(fileInfo os.FileInfo) bool {
+	return os.SameFile(h.fileInfo, fileInfo) &&
+		h.fileInfo.Size() == fileInfo.Size() &&
+		h.fileInfo.ModTime().Equal(fileInfo.ModTime())
+}
+
+// NewFeedWriter ...
+func NewFeedWriter() *FeedWriter {
+	return &FeedWriter{locks: make(map[string]*sync.RWMutex)}
+}
+
+// lock returns the lock of the file fn
+func (w *FeedWriter) lock(fn string) *sync.RWMutex {
+	fn = filepath.Clean(fn)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	mu, ok := w.locks[fn]
+	if !ok {
+		mu = &sync.RWMutex{}
+		w.locks[fn] = mu
+	}
+	return mu
+}
+
+// written calls Written with the file fn if the write to it succeeded, it is
+// deferred before the file is locked so it runs once it is unlocked
+func (w *FeedWriter) written(fn string, err *error) {
+	if *err == nil && w.Written != nil {
+		w.Written(fn)
+	}
+}
+
+// Open opens the file fn for reading and returns it along with its FileInfo
+// taken when no write was in progress. Appends only ever add to the end of
+// the file and rewrites replace it, so reading up to the size in the FileInfo
+// always reads a whole version of the file.
+func (w *FeedWriter) Open(fn string) (*os.File, os.FileInfo, error) {
+	mu := w.lock(fn)
+	mu.RLock()
+	defer mu.RUnlock()
+
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, fileInfo, nil
+}
+
+// Hash returns a hash of the content of the file fn, opened as f by Open(),
+// as it was when fileInfo was taken. Hashes are cached (see fileHash) so the
+// file is only read again once it has been written.
+func (w *FeedWriter) Hash(fn string, f io.ReaderAt, fileInfo os.FileInfo) (string, error) {
+	fn = filepath.Clean(fn)
+
+	w.mu.Lock()
+	cached, ok := w.hashes[fn]
+	w.mu.Unlock()
+	if ok && cached.matches(fileInfo) {
+		return cached.hash, nil
+	}
+
+	h, err := blake2b.New256(nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, fileInfo.Size())); err != nil {
+		return "", err
+	}
+	hash := fmt.Sprintf("%x", h.Sum(nil))
+
+	w.mu.Lock()
+	if w.hashes == nil {
+		w.hashes = make(map[string]fileHash)
+	}
+	w.hashes[fn] = fileHash{fileInfo: fileInfo, hash: hash}
+	w.mu.Unlock()
+
+	return hash, nil
+}
+
+// Append appends data to the file fn, creating it if it does not exist, and
+// syncs it to disk
+func (w *FeedWriter) Append(fn string, data []byte) (err error) {
+	defer w.written(fn, &err)
+
+	mu := w.lock(fn)
+	mu.Lock()
+	defer mu.Unlock()
+
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Replace atomically replaces the file fn with data, see replaceFile()
+func (w *FeedWriter) Replace(fn string, data []byte) (err error) {
+	defer w.written(fn, &err)
+
+	mu := w.lock(fn)
+	mu.Lock()
+	defer mu.Unlock()
+
+	return replaceFile(fn, data)
+}
+
+// Rewrite reads the file fn and atomically replaces it with what rewrite
+// returns, see replaceFile(). The file is locked throughout so no other write
+// can get in between. If rewrite returns an error the file is left untouched
+// and the error returned, unless it is ErrFeedUnchanged.
+func (w *FeedWriter) Rewrite(fn string, rewrite func(data []byte) ([]byte, error)) (err error) {
+	defer w.written(fn, &err)
+
+	mu := w.lock(fn)
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	data, err = rewrite(data)
+	if err != nil {
+		if err == ErrFeedUnchanged {
+			return nil
+		}
+		return err
+	}
+
+	return replaceFile(fn, data)
+}
+
+// replaceFile atomically replaces the file fn with data by writing it to a
+// temporary file in the same directory, syncing it to disk and renaming it
+// over fn
+func replaceFile(fn string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(fn), filepath.Base(fn)+snapshotTempSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	// Temporary files are only readable by us, feeds are not
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), fn)
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twtxt-feed-writer-*")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	w := NewFeedWriter()
+	fn := filepath.Join(dir, "alice")
+
+	t.Run("Concurrent", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var (
+			wg       sync.WaitGroup
+			expected []string
+		)
+		for i := 0; i < 50; i++ {
+			line := fmt.Sprintf("2020-12-01T00:00:%02dZ\ttwt %d", i, i)
+			expected = append(expected, line)
+
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				assert.NoError(w.Append(fn, []byte(line+"\n")))
+			}()
+			// Rewrites that leave the feed as it is must not lose appends
+			go func() {
+				defer wg.Done()
+				err := w.Rewrite(fn, func(data []byte) ([]byte, error) {
+					return append([]byte{}, data...), nil
+				})
+				if !os.IsNotExist(err) {
+					assert.NoError(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		data, err := ioutil.ReadFile(fn)
+		assert.NoError(err)
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		sort.Strings(lines)
+		sort.Strings(expected)
+		assert.Equal(expected, lines)
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		assert := assert.New(t)
+
+		before, err := ioutil.ReadFile(fn)
+		assert.NoError(err)
+
+		assert.NoError(w.Rewrite(fn, func(data []byte) ([]byte, error) {
+			return nil, ErrFeedUnchanged
+		}))
+		assert.Equal(ErrTwtNotFound, w.Rewrite(fn, func(data []byte) ([]byte, error) {
+			return nil, ErrTwtNotFound
+		}))
+
+		after, err := ioutil.ReadFile(fn)
+		assert.NoError(err)
+		assert.Equal(before, after)
+	})
+
+	t.Run("Open", func(t *testing.T) {
+		assert := assert.New(t)
+
+		f, fileInfo, err := w.Open(fn)
+		assert.NoError(err)
+		defer f.Close()
+
+		// Replacing the feed does not change the version already opened
+		assert.NoError(w.Replace(fn, []byte("2020-12-02T00:00:00Z\treplaced\n")))
+
+		data, err := ioutil.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(fileInfo.Size(), int64(len(data)))
+		assert.Equal(50, strings.Count(string(data), "\n"))
+
+		files, err := ioutil.ReadDir(dir)
+		assert.NoError(err)
+		assert.Len(files, 1)
+	})
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+// feedRangeOverlap is the number of bytes at the end of a feed that are
+// requested again by a Range request to check the feed has only been
+// appended to since it was last fetched
+const feedRangeOverlap = 256
+
+var (
+	ErrFeedRewritten            = errors.New("error: feed was rewritten since it was last fetched")
+	ErrUnexpectedNotModified    = errors.New("error: feed not modified but never fetched")
+	ErrUnexpectedPartialContent = errors.New("error: feed partially fetched but never fetched in full")
+)
+
+// tailRecorder is an io.Reader that counts the bytes read through it and
+// remembers the last feedRangeOverlap of them
+type tailRecorder struct {
+	r    io.Reader
+	n    int64
+	tail []byte
+}
+
+func (t *tailRecorder) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+	t.tail = append(t.tail, p[:n]...)
+	if len(t.tail) > feedRangeOverlap {
+		t.tail = append([]byte(nil), t.tail[len(t.tail)-feedRangeOverlap:]...)
+	}
+	return n, err
+}
+
+// ifRange returns the validator a Range request for the feed is made
+// conditional on with If-Range, its ETag if it is a strong one or else its
+// Last-Modified, or "" if it has neither
+func (cached *Cached) ifRange() string {
+	if cached.ETag != "" && !strings.HasPrefix(cached.ETag, "W/") {
+		return cached.ETag
+	}
+	return cached.Lastmodified
+}
+
+// rangeStart returns the offset to request the feed from with a Range
+// request or 0 if the feed has to be fetched in full
+func (cached *Cached) rangeStart() int64 {
+	if cached == nil || cached.Length == 0 || len(cached.Tail) == 0 || cached.ifRange() == "" {
+		return 0
+	}
+	// Only ever resume after a complete line
+	if cached.Tail[len(cached.Tail)-1] != '\n' {
+		return 0
+	}
+	return cached.Length - int64(len(cached.Tail))
+}
+
+// checkFeedOverlap checks that a 206 Partial Content response starts at
+// start and with the bytes previously fetched at the end of the feed,
+// consuming them, so that the rest of the response's body is what has been
+// appended to the feed since.
+func checkFeedOverlap(res *http.Response, prev *Cached, start int64) error {
+	var first int64
+	if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-", &first); err != nil {
+		return err
+	}
+	if first != start {
+		return fmt.Errorf("error: unexpected Content-Range %q", res.Header.Get("Content-Range"))
+	}
+
+	overlap := make([]byte, len(prev.Tail))
+	if _, err := io.ReadFull(res.Body, overlap); err != nil {
+		return err
+	}
+	if !bytes.Equal(overlap, prev.Tail) {
+		return ErrFeedRewritten
+	}
+
+	return nil
+}
+
+// requestFeed requests the feed at url. If the feed's previously cached
+// twts (prev) allow it only what has been appended since is requested with a
+// Range request, conditional on the feed being unchanged since with
+// If-Range so that the server sends it in full if it has changed at all.
+// A 206 Partial Content response is only ever returned with its body
+// positioned at the first new byte, should the server ignore If-Range and
+// the feed have been rewritten rather than appended to it is requested again
+// in full.
+func requestFeed(conf *Config, url string, headers http.Header, prev *Cached) (*http.Response, error) {
+	start := prev.rangeStart()
+	if start > 0 {
+		headers.Set("Range", fmt.Sprintf("bytes=%d-", start))
+		headers.Set("If-Range", prev.ifRange())
+	}
+
+	res, err := Request(conf, http.MethodGet, url, headers)
+	if err != nil || start == 0 {
+		return res, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusPartialContent: // 206
+		err := checkFeedOverlap(res, prev, start)
+		if err == nil {
+			return res, nil
+		}
+		log.WithError(err).Infof("feed %s has changed, fetching it in full", url)
+	case http.StatusRequestedRangeNotSatisfiable: // 416
+		log.Infof("feed %s has shrunk, fetching it in full", url)
+	default:
+		return res, nil
+	}
+	res.Body.Close()
+
+	headers.Del("Range")
+	headers.Del("If-Range")
+	headers.Del("If-Modified-Since")
+	headers.Del("If-None-Match")
+
+	return Request(conf, http.MethodGet, url, headers)
+}
+
+// mergeTwts merges newly fetched twts into a feed's cached twts and returns
+// the twts to keep in the cache (newest first) and those that have expired
+// (older than ttl or more than n)
+func mergeTwts(cached, fetched types.Twts, ttl time.Duration, n int) (types.Twts, types.Twts) {
+	var twts, old types.Twts
+
+	oldTime := time.Now().Add(-ttl)
+	seen := make(map[string]bool)
+
+	for _, twt := range append(fetched, cached...) {
+		if seen[twt.Hash()] {
+			continue
+		}
+		seen[twt.Hash()] = true
+
+		if ttl > 0 && twt.Created().Before(oldTime) {
+			old = append(old, twt)
+		} else {
+			twts = append(twts, twt)
+		}
+	}
+
+	sort.Sort(twts)
+
+	if n > 0 && len(twts) > n {
+		old = append(old, twts[n:]...)
+		twts = twts[:n]
+	}
+
+	return twts, old
+}
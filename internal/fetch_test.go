@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+func TestRequestFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	content := strings.Repeat("2020-12-01T00:00:00Z\tHello World!\n", 20)
+
+	// etag is the ETag the feed is served with, the hash of its content if
+	// it is empty
+	var etag string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag != "" {
+			w.Header().Set("Etag", etag)
+		} else {
+			w.Header().Set("Etag", fmt.Sprintf(`"%s"`, FastHash(content)))
+		}
+		http.ServeContent(w, r, "twtxt.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	conf := NewConfig()
+
+	fetch := func(prev *Cached) (*http.Response, *Cached, string) {
+		res, err := requestFeed(conf, server.URL, make(http.Header), prev)
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+		defer res.Body.Close()
+
+		body := &tailRecorder{r: res.Body}
+		if res.StatusCode == http.StatusPartialContent {
+			body.n = prev.Length
+			body.tail = append([]byte(nil), prev.Tail...)
+		}
+		data, err := ioutil.ReadAll(body)
+		assert.NoError(err)
+
+		return res, &Cached{ETag: res.Header.Get("Etag"), Length: body.n, Tail: body.tail}, string(data)
+	}
+
+	res, cached, data := fetch(nil)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal(content, data)
+	assert.Equal(int64(len(content)), cached.Length)
+	assert.Len(cached.Tail, feedRangeOverlap)
+
+	// A feed that has changed since is fetched in full, even if only the
+	// middle of it has
+	content = strings.Replace(content, "Hello World!", "Hello Earth!", 1)
+	res, cached, data = fetch(cached)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal(content, data)
+
+	// Only what was appended is fetched while the validator is unchanged
+	etag = `"v1"`
+	_, cached, _ = fetch(nil)
+	appended := "2020-12-02T00:00:00Z\tHello again!\n"
+	content += appended
+	res, cached, data = fetch(cached)
+	assert.Equal(http.StatusPartialContent, res.StatusCode)
+	assert.Equal(appended, data)
+	assert.Equal(int64(len(content)), cached.Length)
+	assert.Equal(content[len(content)-feedRangeOverlap:], string(cached.Tail))
+
+	// A rewritten feed is fetched in full even if the validator is unchanged
+	content = strings.Repeat("2020-12-03T00:00:00Z\tRewritten!\n", 20)
+	res, _, data = fetch(cached)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal(content, data)
+
+	// Without a validator to make it conditional on no Range request is made
+	res, _, _ = fetch(&Cached{Length: cached.Length, Tail: cached.Tail})
+	assert.Equal(http.StatusOK, res.StatusCode)
+}
+
+func TestMergeTwts(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+
+	cached := types.Twts{
+		newTestTwt("b", now.Add(-2*time.Hour)),
+		newTestTwt("a", now.Add(-48*time.Hour)),
+	}
+	fetched := types.Twts{
+		newTestTwt("d", now),
+		newTestTwt("c", now.Add(-1*time.Hour)),
+		newTestTwt("b", now.Add(-2*time.Hour)),
+	}
+
+	twts, old := mergeTwts(cached, fetched, 24*time.Hour, 2)
+	assert.Equal([]string{"d", "c"}, hashes(twts))
+	assert.Equal([]string{"a", "b"}, hashes(old))
+}
@@ -47,19 +47,25 @@ func (s *Server) FollowHandler() httprouter.Handle {
 			return
 		}
 
-		if err := s.db.SetUser(ctx.Username, user); err != nil {
+		// The user and the local user or feed they follow (if any) are
+		// updated together so the follow graph stays consistent.
+		batch := NewBatch()
+
+		if err := batch.SetUser(ctx.Username, user); err != nil {
 			ctx.Error = true
 			ctx.Message = fmt.Sprintf("Error following feed %s: %s", nick, url)
 			s.render("error", w, ctx)
 			return
 		}
 
+		var followee string
+
 		if strings.HasPrefix(url, s.config.BaseURL) {
 			url = UserURL(url)
 			nick := NormalizeUsername(filepath.Base(url))
 
 			if s.db.HasUser(nick) {
-				followee, err := s.db.GetUser(nick)
+				followeeUser, err := s.db.GetUser(nick)
 				if err != nil {
 					log.WithError(err).Errorf("error loading user object for %s", nick)
 					ctx.Error = true
@@ -68,32 +74,17 @@ func (s *Server) FollowHandler() httprouter.Handle {
 					return
 				}
 
-				if followee.Followers == nil {
-					followee.Followers = make(map[string]string)
-				}
-
-				followee.Followers[user.Username] = user.URL
+				followeeUser.Followers[user.Username] = user.URL
 
-				if err := s.db.SetUser(followee.Username, followee); err != nil {
-					log.WithError(err).Warnf("error updating user object for followee %s", followee.Username)
+				if err := batch.SetUser(followeeUser.Username, followeeUser); err != nil {
+					log.WithError(err).Warnf("error updating user object for followee %s", followeeUser.Username)
 					ctx.Error = true
 					ctx.Message = "Error following user"
 					s.render("error", w, ctx)
 					return
 				}
 
-				if _, err := AppendSpecial(
-					s.config, s.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						followee.Username, URLForUser(s.config, followee.Username),
-						user.Username, URLForUser(s.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
+				followee = followeeUser.Username
 			} else if s.db.HasFeed(nick) {
 				feed, err := s.db.GetFeed(nick)
 				if err != nil {
@@ -106,7 +97,7 @@ func (s *Server) FollowHandler() httprouter.Handle {
 
 				feed.Followers[user.Username] = user.URL
 
-				if err := s.db.SetFeed(feed.Name, feed); err != nil {
+				if err := batch.SetFeed(feed.Name, feed); err != nil {
 					log.WithError(err).Warnf("error updating user object for followee %s", feed.Name)
 					ctx.Error = true
 					ctx.Message = "Error following feed"
@@ -114,18 +105,30 @@ func (s *Server) FollowHandler() httprouter.Handle {
 					return
 				}
 
-				if _, err := AppendSpecial(
-					s.config, s.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						feed.Name, URLForUser(s.config, feed.Name),
-						user.Username, URLForUser(s.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
-				}
+				followee = feed.Name
+			}
+		}
+
+		if err := s.db.Commit(batch); err != nil {
+			log.WithError(err).Errorf("error saving follow of %s by %s", url, user.Username)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error following feed %s: %s", nick, url)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if followee != "" {
+			if _, err := AppendSpecial(
+				s.config, s.cache.feedWriter, s.db,
+				twtxtBot,
+				fmt.Sprintf(
+					"FOLLOW: @<%s %s> from @<%s %s> using %s/%s",
+					followee, URLForUser(s.config, followee),
+					user.Username, URLForUser(s.config, user.Username),
+					"twtxt", twtxt.FullVersion(),
+				),
+			); err != nil {
+				log.WithError(err).Warnf("error appending special FOLLOW post")
 			}
 		}
 
@@ -227,41 +230,69 @@ func (s *Server) UnfollowHandler() httprouter.Handle {
 
 		delete(user.Following, nick)
 
-		if err := s.db.SetUser(ctx.Username, user); err != nil {
+		batch := NewBatch()
+
+		if err := batch.SetUser(ctx.Username, user); err != nil {
 			ctx.Error = true
 			ctx.Message = fmt.Sprintf("Error unfollowing feed %s: %s", nick, url)
 			s.render("error", w, ctx)
 			return
 		}
 
+		var followee string
+
 		if strings.HasPrefix(url, s.config.BaseURL) {
 			url = UserURL(url)
 			nick := NormalizeUsername(filepath.Base(url))
-			followee, err := s.db.GetUser(nick)
-			if err != nil {
-				log.WithError(err).Warnf("error loading user object for followee %s", nick)
-			} else {
-				if followee.Followers != nil {
-					delete(followee.Followers, user.Username)
-					if err := s.db.SetUser(followee.Username, followee); err != nil {
-						log.WithError(err).Warnf("error updating user object for followee %s", followee.Username)
+
+			if s.db.HasUser(nick) {
+				followeeUser, err := s.db.GetUser(nick)
+				if err != nil {
+					log.WithError(err).Warnf("error loading user object for followee %s", nick)
+				} else {
+					delete(followeeUser.Followers, user.Username)
+					if err := batch.SetUser(followeeUser.Username, followeeUser); err != nil {
+						log.WithError(err).Warnf("error updating user object for followee %s", followeeUser.Username)
 					}
+					followee = followeeUser.Username
 				}
-				if _, err := AppendSpecial(
-					s.config, s.db,
-					twtxtBot,
-					fmt.Sprintf(
-						"UNFOLLOW: @<%s %s> from @<%s %s> using %s/%s",
-						followee.Username, URLForUser(s.config, followee.Username),
-						user.Username, URLForUser(s.config, user.Username),
-						"twtxt", twtxt.FullVersion(),
-					),
-				); err != nil {
-					log.WithError(err).Warnf("error appending special FOLLOW post")
+			} else if s.db.HasFeed(nick) {
+				feed, err := s.db.GetFeed(nick)
+				if err != nil {
+					log.WithError(err).Warnf("error loading feed object for followee %s", nick)
+				} else {
+					delete(feed.Followers, user.Username)
+					if err := batch.SetFeed(feed.Name, feed); err != nil {
+						log.WithError(err).Warnf("error updating feed object for followee %s", feed.Name)
+					}
+					followee = feed.Name
 				}
 			}
 		}
 
+		if err := s.db.Commit(batch); err != nil {
+			log.WithError(err).Errorf("error saving unfollow of %s by %s", url, user.Username)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error unfollowing feed %s: %s", nick, url)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if followee != "" {
+			if _, err := AppendSpecial(
+				s.config, s.cache.feedWriter, s.db,
+				twtxtBot,
+				fmt.Sprintf(
+					"UNFOLLOW: @<%s %s> from @<%s %s> using %s/%s",
+					followee, URLForUser(s.config, followee),
+					user.Username, URLForUser(s.config, user.Username),
+					"twtxt", twtxt.FullVersion(),
+				),
+			); err != nil {
+				log.WithError(err).Warnf("error appending special FOLLOW post")
+			}
+		}
+
 		ctx.Error = false
 		ctx.Message = fmt.Sprintf("Successfully stopped following %s: %s", nick, url)
 		s.render("error", w, ctx)
@@ -12,7 +12,6 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 	"time"
 
@@ -578,20 +577,41 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			return
 		}
 
-		fileInfo, err := os.Stat(fn)
+		// Open the feed through the FeedWriter and serve it as it is now, not
+		// as it may be halfway through a write by the time it is read
+		f, fileInfo, err := s.cache.feedWriter.Open(fn)
 		if err != nil {
 			if os.IsNotExist(err) {
 				http.Error(w, "Feed Not Found", http.StatusNotFound)
 				return
 			}
 
+			log.WithError(err).Error("error opening feed")
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		defer f.Close()
+
+		// Describe the feed with metadata headers at the top of it, bots and
+		// other special feeds have no user or feed so only get a nick and url
+		var meta *types.Metadata
+		if user, err := s.db.GetUser(nick); err == nil {
+			meta = user.Metadata(s.config)
+		} else if feed, err := s.db.GetFeed(nick); err == nil {
+			meta = feed.Metadata(s.config)
+		} else {
+			meta = &types.Metadata{Nick: nick, URL: URLForUser(s.config, nick)}
+		}
+		header := meta.String() + "#\n"
 
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.Header().Set("Link", fmt.Sprintf(`<%s/user/%s/webmention>; rel="webmention"`, s.config.BaseURL, nick))
 		w.Header().Set("Last-Modified", fileInfo.ModTime().UTC().Format(http.TimeFormat))
+		if hash, err := s.cache.feedWriter.Hash(fn, f, fileInfo); err != nil {
+			log.WithError(err).Warnf("error hashing feed %s", nick)
+		} else {
+			w.Header().Set("Etag", feedETag(header, hash))
+		}
 
 		followerClient, err := DetectFollowerFromUserAgent(r.UserAgent())
 		if err != nil {
@@ -603,7 +623,7 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			} else {
 				if !user.FollowedBy(followerClient.URL) {
 					if _, err := AppendSpecial(
-						s.config, s.db,
+						s.config, s.cache.feedWriter, s.db,
 						twtxtBot,
 						fmt.Sprintf(
 							"FOLLOW: @<%s %s> from @<%s %s> using %s",
@@ -622,18 +642,55 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			}
 		}
 
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		content := io.NewSectionReader(
+			&prefixedReaderAt{prefix: []byte(header), r: f},
+			0, int64(len(header))+fileInfo.Size(),
+		)
+		http.ServeContent(w, r, filepath.Base(fn), fileInfo.ModTime(), content)
+	}
+}
+
+// FeedArchiveHandler serves the archive files twts of local feeds have been
+// rotated into, see RotateFeed()
+func (s *Server) FeedArchiveHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		nick := NormalizeUsername(p.ByName("nick"))
+		if nick == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		fn, err := securejoin.SecureJoin(filepath.Join(s.config.Data, archivedFeedsDir, nick), p.ByName("name"))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
 		f, err := os.Open(fn)
 		if err != nil {
-			log.WithError(err).Error("error opening feed")
+			if os.IsNotExist(err) {
+				http.Error(w, "Archive Not Found", http.StatusNotFound)
+				return
+			}
+			log.WithError(err).Error("error opening feed archive")
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 		defer f.Close()
 
-		if r.Method == http.MethodHead {
+		fileInfo, err := f.Stat()
+		if err != nil || fileInfo.IsDir() {
+			http.Error(w, "Archive Not Found", http.StatusNotFound)
 			return
 		}
 
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Etag", fmt.Sprintf(`"%x-%x"`, fileInfo.ModTime().UnixNano(), fileInfo.Size()))
+
 		http.ServeContent(w, r, filepath.Base(fn), fileInfo.ModTime(), f)
 	}
 }
@@ -646,43 +703,50 @@ func (s *Server) PostHandler() httprouter.Handle {
 		ctx := NewContext(s.config, s.db, r)
 
 		postas := strings.ToLower(strings.TrimSpace(r.FormValue("postas")))
+		hash := strings.TrimSpace(r.FormValue("hash"))
 
-		// TODO: Support deleting/patching last feed (`postas`) twt too.
-		if r.Method == http.MethodDelete || r.Method == http.MethodPatch {
-			if err := DeleteLastTwt(s.config, ctx.User); err != nil {
-				ctx.Error = true
-				ctx.Message = "Error deleting last twt"
-				s.render("error", w, ctx)
-			}
-
-			// Update user's own timeline with their own new post.
-			s.cache.FetchTwts(s.config, s.archive, ctx.User.Source(), nil)
-
-			// Re-populate/Warm cache with local twts for this pod
-			s.cache.GetByPrefix(s.config.BaseURL, true)
-
-			if r.Method != http.MethodDelete {
-				return
-			}
-		}
-
-		hash := r.FormValue("hash")
-		lastTwt, _, err := GetLastTwt(s.config, ctx.User)
+		user, err := s.db.GetUser(ctx.Username)
 		if err != nil {
+			log.WithError(err).Errorf("error loading user object for %s", ctx.Username)
 			ctx.Error = true
-			ctx.Message = "Error deleting last twt"
+			ctx.Message = "Error posting twt"
 			s.render("error", w, ctx)
 			return
 		}
 
-		if hash != "" && lastTwt.Hash() == hash {
-			if err := DeleteLastTwt(s.config, ctx.User); err != nil {
+		// The feed posted to or whose twt is edited or deleted is either the
+		// user's own or one of the feeds they own
+		feed := user.Username
+		if postas != "" && postas != user.Username {
+			if !user.OwnsFeed(postas) {
+				log.WithError(ErrFeedImposter).Errorf("error posting as %s", postas)
 				ctx.Error = true
-				ctx.Message = "Error deleting last twt"
+				ctx.Message = "Error posting twt"
 				s.render("error", w, ctx)
+				return
 			}
-		} else {
-			log.Warnf("hash mismatch %s != %s", lastTwt.Hash(), hash)
+			feed = postas
+		}
+
+		if r.Method == http.MethodDelete {
+			if hash == "" {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			twt, err := DeleteTwt(s.config, s.cache.feedWriter, feed, hash)
+			if err != nil {
+				log.WithError(err).Errorf("error deleting twt %s from %s", hash, feed)
+				if err == ErrTwtNotFound {
+					http.Error(w, "Twt Not Found", http.StatusNotFound)
+				} else {
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				}
+				return
+			}
+			s.cache.UpdateArchived(s.archive, twt, nil)
+
+			return
 		}
 
 		text := CleanTwt(r.FormValue("text"))
@@ -703,34 +767,22 @@ func (s *Server) PostHandler() httprouter.Handle {
 			}
 		}
 
-		user, err := s.db.GetUser(ctx.Username)
-		if err != nil {
-			log.WithError(err).Errorf("error loading user object for %s", ctx.Username)
-			ctx.Error = true
-			ctx.Message = "Error posting twt"
-			s.render("error", w, ctx)
-			return
-		}
-
-		var twt types.Twt = types.NilTwt
+		var (
+			old types.Twt
+			twt types.Twt = types.NilTwt
+		)
 
-		switch postas {
-		case "", user.Username:
-			if hash != "" && lastTwt.Hash() == hash {
-				twt, err = AppendTwt(s.config, s.db, user, text, lastTwt.Created)
-			} else {
-				twt, err = AppendTwt(s.config, s.db, user, text)
-			}
+		// Editing (with a hash) keeps the twt where it is in the feed along
+		// with its Created timestamp
+		switch {
+		case hash != "" && feed == user.Username:
+			old, twt, err = EditTwt(s.config, s.cache.feedWriter, s.db, user, hash, text)
+		case hash != "":
+			old, twt, err = EditSpecial(s.config, s.cache.feedWriter, s.db, feed, hash, text)
+		case feed == user.Username:
+			twt, err = AppendTwt(s.config, s.cache.feedWriter, s.db, user, text)
 		default:
-			if user.OwnsFeed(postas) {
-				if hash != "" && lastTwt.Hash() == hash {
-					twt, err = AppendSpecial(s.config, s.db, postas, text, lastTwt.Created)
-				} else {
-					twt, err = AppendSpecial(s.config, s.db, postas, text)
-				}
-			} else {
-				err = ErrFeedImposter
-			}
+			twt, err = AppendSpecial(s.config, s.cache.feedWriter, s.db, feed, text)
 		}
 
 		if err != nil {
@@ -741,11 +793,9 @@ func (s *Server) PostHandler() httprouter.Handle {
 			return
 		}
 
-		// Update user's own timeline with their own new post.
-		s.cache.FetchTwts(s.config, s.archive, user.Source(), nil)
-
-		// Re-populate/Warm cache with local twts for this pod
-		s.cache.GetByPrefix(s.config.BaseURL, true)
+		if old != nil {
+			s.cache.UpdateArchived(s.archive, old, twt)
+		}
 
 		// WebMentions ...
 		for _, m := range twt.Mentions() {
@@ -772,26 +822,25 @@ func (s *Server) TimelineHandler() httprouter.Handle {
 
 		ctx := NewContext(s.config, s.db, r)
 
-		var twts types.Twts
+		var twts paginator.Adapter
 
 		if !ctx.Authenticated {
-			twts = s.cache.GetByPrefix(s.config.BaseURL, false)
+			twts = adapter.NewSliceAdapter(s.cache.GetByPrefix(s.config.BaseURL, false))
 			ctx.Title = "Local timeline"
 		} else {
 			ctx.Title = "Timeline"
 			user := ctx.User
 			if user != nil {
-				for feed := range user.Sources() {
-					twts = append(twts, s.cache.GetByURL(feed.URL)...)
-				}
+				twts = timelineAdapter{cache: s.cache, feeds: user.Sources()}
+			} else {
+				twts = adapter.NewSliceAdapter(types.Twts{})
 			}
-			sort.Sort(twts)
 		}
 
 		var pagedTwts types.Twts
 
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(twts, s.config.TwtsPerPage)
 		pager.SetPage(page)
 
 		if err := pager.Results(&pagedTwts); err != nil {
@@ -802,18 +851,6 @@ func (s *Server) TimelineHandler() httprouter.Handle {
 			return
 		}
 
-		if ctx.Authenticated {
-			lastTwt, _, err := GetLastTwt(s.config, ctx.User)
-			if err != nil {
-				log.WithError(err).Error("error getting user last twt")
-				ctx.Error = true
-				ctx.Message = "An error occurred while loading the timeline"
-				s.render("error", w, ctx)
-				return
-			}
-			ctx.LastTwt = lastTwt
-		}
-
 		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
 		ctx.Pager = &pager
 
@@ -830,6 +867,41 @@ func (s *Server) WebMentionHandler() httprouter.Handle {
 	}
 }
 
+// lookupTwt looks up the twt with the given hash for the permalink and
+// conversation pages in the cache and archive. If the hashes of more than one
+// twt collide it renders a page to choose between them, which link back with
+// the twter and created query parameters to pick one (see selectTwts()). If
+// there is no single twt it returns false having rendered an error or that
+// page.
+func (s *Server) lookupTwt(w http.ResponseWriter, r *http.Request, ctx *Context, hash string) (types.Twt, bool) {
+	twts, err := s.cache.LookupAll(s.archive, hash)
+	if err != nil {
+		log.WithError(err).Errorf("error looking up twt %s", hash)
+		ctx.Error = true
+		ctx.Message = "Error loading twt from archive, please try again"
+		s.render("error", w, ctx)
+		return types.NilTwt, false
+	}
+
+	twts = selectTwts(twts, r.FormValue("twter"), r.FormValue("created"))
+
+	switch len(twts) {
+	case 0:
+		ctx.Error = true
+		ctx.Message = "No matching twt found!"
+		s.render("404", w, ctx)
+		return types.NilTwt, false
+	case 1:
+		return twts[0], true
+	}
+
+	ctx.Title = fmt.Sprintf("Twts #%s", hash)
+	ctx.Disambiguate = r.URL.Path
+	ctx.Twts = FilterTwts(ctx.User, twts)
+	s.render("disambiguation", w, ctx)
+	return types.NilTwt, false
+}
+
 // PermalinkHandler ...
 func (s *Server) PermalinkHandler() httprouter.Handle {
 	isLocal := IsLocalURLFactory(s.config)
@@ -843,29 +915,13 @@ func (s *Server) PermalinkHandler() httprouter.Handle {
 			return
 		}
 
-		var err error
-
-		twt, ok := s.cache.Lookup(hash)
+		twt, ok := s.lookupTwt(w, r, ctx, hash)
 		if !ok {
-			// If the twt is not in the cache look for it in the archive
-			if s.archive.Has(hash) {
-				twt, err = s.archive.Get(hash)
-				if err != nil {
-					ctx.Error = true
-					ctx.Message = "Error loading twt from archive, please try again"
-					s.render("error", w, ctx)
-					return
-				}
-			}
-		}
-
-		if twt.IsZero() {
-			ctx.Error = true
-			ctx.Message = "No matching twt found!"
-			s.render("404", w, ctx)
 			return
 		}
 
+		var err error
+
 		var (
 			who   string
 			image string
@@ -970,18 +1026,6 @@ func (s *Server) DiscoverHandler() httprouter.Handle {
 			return
 		}
 
-		if ctx.Authenticated {
-			lastTwt, _, err := GetLastTwt(s.config, ctx.User)
-			if err != nil {
-				log.WithError(err).Error("error getting user last twt")
-				ctx.Error = true
-				ctx.Message = "An error occurred while loading the timeline"
-				s.render("error", w, ctx)
-				return
-			}
-			ctx.LastTwt = lastTwt
-		}
-
 		ctx.Title = "Local timeline"
 		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
 		ctx.Pager = &pager
@@ -995,8 +1039,7 @@ func (s *Server) MentionsHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := NewContext(s.config, s.db, r)
 
-		twts := s.cache.GetMentions(ctx.User)
-		sort.Sort(twts)
+		twts := s.cache.GetMentions(s.config, ctx.User)
 
 		var pagedTwts types.Twts
 
@@ -1018,37 +1061,95 @@ func (s *Server) MentionsHandler() httprouter.Handle {
 	}
 }
 
+// LintHandler ...
+func (s *Server) LintHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+		ctx.Title = "Lint a feed"
+
+		if r.Method == http.MethodGet {
+			ctx.LintURL = strings.TrimSpace(r.URL.Query().Get("url"))
+			s.render("lint", w, ctx)
+			return
+		}
+
+		ctx.LintURL = strings.TrimSpace(r.FormValue("url"))
+		ctx.LintFeed = r.FormValue("feed")
+
+		var (
+			report *types.LintReport
+			err    error
+		)
+
+		switch {
+		case ctx.LintURL != "" && !ctx.Authenticated:
+			ctx.Error = true
+			ctx.Message = "Login to lint a feed by its url, or paste its contents"
+			s.render("lint", w, ctx)
+			return
+		case ctx.LintURL != "":
+			report, err = LintFeed(s.config, ctx.LintURL)
+		case strings.TrimSpace(ctx.LintFeed) != "":
+			report, err = types.LintFile(strings.NewReader(ctx.LintFeed), types.Twter{})
+		default:
+			ctx.Error = true
+			ctx.Message = "Enter the url of a feed or paste its contents"
+			s.render("lint", w, ctx)
+			return
+		}
+
+		if err != nil {
+			log.WithError(err).Error("error linting feed")
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error linting feed: %s", err)
+			s.render("lint", w, ctx)
+			return
+		}
+
+		ctx.LintReport = report
+		s.render("lint", w, ctx)
+	}
+}
+
 // SearchHandler ...
 func (s *Server) SearchHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s.config, s.db, r)
 
-		var twts types.Twts
-
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
 		tag := r.URL.Query().Get("tag")
 
-		if tag == "" {
-			ctx.Error = true
-			ctx.Message = "At least search query is required"
-			s.render("error", w, ctx)
+		if q == "" && tag == "" {
+			s.render("search", w, ctx)
+			return
 		}
 
-		getTweetsByTag := func() types.Twts {
-			var result types.Twts
-			seen := make(map[string]bool)
-			// TODO: Improve this by making this an O(1) lookup on the tag
-			for _, twt := range s.cache.GetAll() {
-				var tags types.TagList = twt.Tags()
-				if HasString(UniqStrings(tags.Tags()), tag) && !seen[twt.Hash()] {
-					result = append(result, twt)
-					seen[twt.Hash()] = true
-				}
+		var (
+			twts types.Twts
+			err  error
+		)
+
+		if q != "" {
+			ctx.SearchQuery = q
+
+			var query *SearchQuery
+			if query, err = ParseSearchQuery(q); err != nil {
+				ctx.Error = true
+				ctx.Message = "Invalid search query"
+				s.render("search", w, ctx)
+				return
 			}
-			return result
+			twts, _, err = s.cache.Search(s.archive, query, "", 0)
+		} else {
+			ctx.SearchQuery = fmt.Sprintf("tag:%s", tag)
+			twts, _, err = s.cache.GetByTag(tag, "", 0)
+		}
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = "An error occurred while loading search results"
+			s.render("error", w, ctx)
+			return
 		}
-
-		twts = getTweetsByTag()
-		sort.Sort(twts)
 
 		var pagedTwts types.Twts
 
@@ -1066,7 +1167,7 @@ func (s *Server) SearchHandler() httprouter.Handle {
 		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
 		ctx.Pager = &pager
 
-		s.render("timeline", w, ctx)
+		s.render("search", w, ctx)
 	}
 }
 
@@ -1084,6 +1185,7 @@ func (s *Server) FeedHandler() httprouter.Handle {
 			return
 		}
 
+		// CreateFeed also saves the user as the owner and follower of the feed
 		if err := CreateFeed(s.config, s.db, ctx.User, name, false); err != nil {
 			ctx.Error = true
 			ctx.Message = fmt.Sprintf("Error creating: %s", err.Error())
@@ -1091,17 +1193,8 @@ func (s *Server) FeedHandler() httprouter.Handle {
 			return
 		}
 
-		ctx.User.Follow(name, URLForUser(s.config, name))
-
-		if err := s.db.SetUser(ctx.Username, ctx.User); err != nil {
-			ctx.Error = true
-			ctx.Message = fmt.Sprintf("Error creating feed: %s", err.Error())
-			s.render("error", w, ctx)
-			return
-		}
-
 		if _, err := AppendSpecial(
-			s.config, s.db,
+			s.config, s.cache.feedWriter, s.db,
 			twtxtBot,
 			fmt.Sprintf(
 				"FEED: @<%s %s> from @<%s %s>",
@@ -1321,6 +1414,12 @@ func (s *Server) RegisterHandler() httprouter.Handle {
 			return
 		}
 
+		if username == s.config.AdminUser {
+			if err := AttachSpecialFeeds(s.config, s.db, user); err != nil {
+				log.WithError(err).Warn("error creating special feeds for admin user")
+			}
+		}
+
 		log.Infof("user registered: %v", user)
 		http.Redirect(w, r, "/login", http.StatusFound)
 	}
@@ -1565,6 +1664,13 @@ func (s *Server) FollowingHandler() httprouter.Handle {
 			return
 		}
 
+		ctx.FeedHealth = make(map[string]*FeedHealth)
+		for _, url := range ctx.Profile.Following {
+			if health := s.cache.GetHealth(url); health != nil {
+				ctx.FeedHealth[url] = health
+			}
+		}
+
 		if r.Header.Get("Accept") == "application/json" {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
@@ -1608,11 +1714,34 @@ func (s *Server) ExternalHandler() httprouter.Handle {
 			s.cache.FetchTwts(s.config, s.archive, sources, nil)
 		}
 
-		twts := s.cache.GetByURL(uri)
+		page := SafeParseInt(r.FormValue("p"), 1)
+
+		// Older twts are fetched from the feed's archive files (if any) on
+		// demand as the last page of what has been fetched so far is reached
+		history := s.cache.GetHistory(s.archive, uri)
+		feed := types.Feed{Nick: nick, URL: uri}
+		for i := 0; i < maxHistoryFetches && s.cache.HasHistory(uri); i++ {
+			if len(s.cache.GetByURL(uri))+len(history) > page*s.config.TwtsPerPage {
+				break
+			}
+			if _, err := s.cache.FetchHistory(s.config, s.archive, feed); err != nil {
+				log.WithError(err).Warnf("error fetching history of %s", uri)
+				break
+			}
+			history = s.cache.GetHistory(s.archive, uri)
+		}
+
+		// Archive files only ever hold twts older than the feed itself
+		twts := append(append(types.Twts{}, s.cache.GetByURL(uri)...), history...)
+
+		// Prefer what the feed declares about itself
+		meta := s.cache.GetMetadata(uri)
+		if meta != nil && meta.Nick != "" {
+			nick = meta.Nick
+		}
 
 		var pagedTwts types.Twts
 
-		page := SafeParseInt(r.FormValue("p"), 1)
 		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
 		pager.SetPage(page)
 
@@ -1629,9 +1758,10 @@ func (s *Server) ExternalHandler() httprouter.Handle {
 
 		if len(ctx.Twts) > 0 {
 			ctx.Twter = ctx.Twts[0].Twter()
+			ctx.Twter.Nick = nick
 		} else {
 			ctx.Twter = types.Twter{Nick: nick, URL: uri}
-			avatar := GetExternalAvatar(s.config, nick, uri)
+			avatar := GetExternalAvatar(s.config, nick, uri, meta)
 			if avatar != "" {
 				ctx.Twter.Avatar = URLForExternalAvatar(s.config, uri)
 			}
@@ -1647,6 +1777,16 @@ func (s *Server) ExternalHandler() httprouter.Handle {
 			Muted:      ctx.User.HasMuted(uri),
 		}
 
+		if meta != nil {
+			ctx.Profile.Tagline = meta.Description
+			ctx.Profile.Following = meta.Following()
+			ctx.Profile.Links = meta.Links
+		}
+
+		if health := s.cache.GetHealth(uri); health != nil {
+			ctx.FeedHealth = map[string]*FeedHealth{uri: health}
+		}
+
 		ctx.Title = fmt.Sprintf("External profile for @<%s %s>", nick, uri)
 		s.render("externalProfile", w, ctx)
 	}
@@ -2173,8 +2313,13 @@ func (s *Server) TransferFeedHandler() httprouter.Handle {
 			}
 
 			// Transfer ownerships
-			_ = RemoveFeedOwnership(s.db, fromUser, feed)
-			_ = AddFeedOwnership(s.db, toUser, feed)
+			if err := TransferFeedOwnership(s.db, fromUser, toUser, feed); err != nil {
+				log.WithError(err).Errorf("Error transferring feed %s to %s", feed.Name, toUser.Username)
+				ctx.Error = true
+				ctx.Message = "Error transferring feed"
+				s.render("error", w, ctx)
+				return
+			}
 
 			ctx.Error = false
 			ctx.Message = "Feed ownership changed successfully."
@@ -2197,6 +2342,10 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 			return
 		}
 
+		// All store records of the account are deleted in a single batch once
+		// the account's files and media have been removed.
+		batch := NewBatch()
+
 		for _, feed := range feeds {
 			// Get user's owned feeds
 			if ctx.User.OwnsFeed(feed.Name) {
@@ -2254,12 +2403,7 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 				}
 
 				// Delete feed
-				if err := s.db.DelFeed(nick); err != nil {
-					ctx.Error = true
-					ctx.Message = "An error occured whilst deleting your account"
-					s.render("error", w, ctx)
-					return
-				}
+				batch.DelFeed(nick)
 
 				// Delete feeds's twtxt.txt
 				fn := filepath.Join(s.config.Data, feedsDir, nick)
@@ -2272,6 +2416,11 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 					}
 				}
 
+				// Delete feed's archive files
+				if err := os.RemoveAll(filepath.Join(s.config.Data, archivedFeedsDir, nick)); err != nil {
+					log.WithError(err).Error("error removing feed's archive files")
+				}
+
 				// Delete feed from cache
 				s.cache.Delete(feed.Source())
 			}
@@ -2325,12 +2474,7 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 		}
 
 		// Delete user's primary feed
-		if err := s.db.DelFeed(ctx.User.Username); err != nil {
-			ctx.Error = true
-			ctx.Message = "An error occured whilst deleting your account"
-			s.render("error", w, ctx)
-			return
-		}
+		batch.DelFeed(ctx.User.Username)
 
 		// Delete user's twtxt.txt
 		fn := filepath.Join(s.config.Data, feedsDir, ctx.User.Username)
@@ -2343,8 +2487,19 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 			}
 		}
 
-		// Delete user
-		if err := s.db.DelUser(ctx.Username); err != nil {
+		// Delete user's archive files
+		if err := os.RemoveAll(filepath.Join(s.config.Data, archivedFeedsDir, ctx.User.Username)); err != nil {
+			log.WithError(err).Error("error removing user's archive files")
+		}
+
+		// Delete user and their tokens
+		for _, signature := range ctx.User.Tokens {
+			batch.DelToken(signature)
+		}
+		batch.DelUser(ctx.Username)
+
+		if err := s.db.Commit(batch); err != nil {
+			log.WithError(err).Errorf("error deleting account %s", ctx.Username)
 			ctx.Error = true
 			ctx.Message = "An error occured whilst deleting your account"
 			s.render("error", w, ctx)
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+// twtKey returns what the hash of a twt is a digest of (its feed's url, when
+// it was created and its text). Hashes are short so different twts can have
+// the same hash but never the same key.
+func twtKey(twt types.Twt) string {
+	return twt.Twter().URL + "\n" + twt.Created().Format(time.RFC3339) + "\n" + twt.Text()
+}
+
+// sameTwt returns true if a and b are the same twt and not just two twts
+// whose hashes collide
+func sameTwt(a, b types.Twt) bool {
+	return a.Hash() == b.Hash() && twtKey(a) == twtKey(b)
+}
+
+// hashIndex maps a hash to the twts (keyed by twtKey) with that hash, of
+// which there is more than one when the hashes of different twts collide
+type hashIndex map[string]map[string]types.Twt
+
+// add adds twt to the index and returns the number of other twts whose hash
+// collides with it
+func (idx hashIndex) add(twt types.Twt) int {
+	twts, ok := idx[twt.Hash()]
+	if !ok {
+		twts = make(map[string]types.Twt)
+		idx[twt.Hash()] = twts
+	}
+	twts[twtKey(twt)] = twt
+	return len(twts) - 1
+}
+
+func (idx hashIndex) remove(twt types.Twt) {
+	twts, ok := idx[twt.Hash()]
+	if !ok {
+		return
+	}
+	delete(twts, twtKey(twt))
+	if len(twts) == 0 {
+		delete(idx, twt.Hash())
+	}
+}
+
+// get returns the twts (newest first) with the given hash
+func (idx hashIndex) get(hash string) types.Twts {
+	var twts types.Twts
+	for _, twt := range idx[hash] {
+		twts = append(twts, twt)
+	}
+	sort.Sort(twts)
+	return twts
+}
+
+// LookupAll returns every twt (newest first) with the given hash whether it
+// is cached or archived. There is more than one if the hashes of different
+// twts collide, see selectTwts().
+func (cache *Cache) LookupAll(archive Archiver, hash string) (types.Twts, error) {
+	cache.mu.RLock()
+	twts := cache.hashes.get(hash)
+	cache.mu.RUnlock()
+
+	if !archive.Has(hash) {
+		return twts, nil
+	}
+
+	archived, err := archive.GetAll(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, twt := range archived {
+		if !twt.IsZero() && !hasTwt(twts, twt) {
+			twts = append(twts, twt)
+		}
+	}
+	sort.Sort(twts)
+
+	return twts, nil
+}
+
+// hasTwt returns true if twts has the twt twt, see sameTwt()
+func hasTwt(twts types.Twts, twt types.Twt) bool {
+	for _, t := range twts {
+		if sameTwt(t, twt) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectTwts returns the twts of twts from the feed twter created at created
+// (as RFC3339), either of which may be empty to match any. It picks one of
+// several twts whose hashes collide by what their hash is a digest of.
+func selectTwts(twts types.Twts, twter, created string) types.Twts {
+	var at time.Time
+	if created != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil
+		}
+	}
+
+	var selected types.Twts
+	for _, twt := range twts {
+		if twter != "" && twt.Twter().URL != twter {
+			continue
+		}
+		if !at.IsZero() && !twt.Created().Truncate(time.Second).Equal(at) {
+			continue
+		}
+		selected = append(selected, twt)
+	}
+	return selected
+}
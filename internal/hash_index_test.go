@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestHashCollisions(t *testing.T) {
+	retwt.DefaultTwtManager()
+
+	alice := types.Twter{Nick: "alice", URL: "https://example.com/twtxt.txt"}
+	parse := func(line string) types.Twt {
+		twt, err := types.ParseLine(line, alice)
+		assert.NoError(t, err)
+		return twt
+	}
+
+	// Different twts whose hashes collide
+	first := parse("2020-12-01T00:00:00Z\tHello 53")
+	second := parse("2020-12-01T00:00:00Z\tHello 79049")
+	other := parse("2020-12-02T00:00:00Z\tHello World")
+	if !assert.Equal(t, first.Hash(), second.Hash()) {
+		return
+	}
+	hash := first.Hash()
+
+	t.Run("DiskArchiver", func(t *testing.T) {
+		assert := assert.New(t)
+
+		dir, err := ioutil.TempDir("", "twtxt-archive-*")
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+
+		archive, err := NewDiskArchiver(dir)
+		assert.NoError(err)
+
+		assert.NoError(archive.Archive(first))
+		assert.NoError(archive.Archive(second))
+		assert.Equal(ErrTwtAlreadyArchived, archive.Archive(first))
+		assert.Equal(ErrTwtAlreadyArchived, archive.Archive(second))
+
+		twts, err := archive.GetAll(hash)
+		assert.NoError(err)
+		assert.Equal([]string{"Hello 53", "Hello 79049"}, texts(twts))
+
+		twt, err := archive.Get(hash)
+		assert.NoError(err)
+		assert.Equal("Hello 53", twt.Text())
+
+		count, err := archive.Count()
+		assert.NoError(err)
+		assert.Equal(2, count)
+
+		assert.NoError(archive.Del(hash))
+		assert.False(archive.Has(hash))
+		_, err = archive.GetAll(hash)
+		assert.Equal(ErrTwtNotArchived, err)
+	})
+
+	t.Run("LookupAll", func(t *testing.T) {
+		assert := assert.New(t)
+
+		archive := make(testArchiver)
+		cache := &Cache{Twts: make(map[string]*Cached)}
+		cache.setCached(alice.URL, &Cached{Twts: types.Twts{other, second}})
+		assert.NoError(archive.Archive(first))
+
+		twt, ok := cache.Lookup(hash)
+		assert.True(ok)
+		assert.Equal("Hello 79049", twt.Text())
+
+		twts, err := cache.LookupAll(archive, hash)
+		assert.NoError(err)
+		assert.Len(twts, 2)
+
+		twts, err = cache.LookupAll(archive, other.Hash())
+		assert.NoError(err)
+		assert.Equal([]string{"Hello World"}, texts(twts))
+
+		// Twts cached and archived are the same twt
+		assert.NoError(archive.Archive(other))
+		twts, err = cache.LookupAll(archive, other.Hash())
+		assert.NoError(err)
+		assert.Len(twts, 1)
+
+		// Removing the cached twt leaves the archived one
+		cache.setCached(alice.URL, &Cached{Twts: types.Twts{other}})
+		twts, err = cache.LookupAll(archive, hash)
+		assert.NoError(err)
+		assert.Equal([]string{"Hello 53"}, texts(twts))
+	})
+
+	t.Run("Indexes", func(t *testing.T) {
+		assert := assert.New(t)
+
+		archive := make(testArchiver)
+		cache := &Cache{Twts: make(map[string]*Cached)}
+		cache.setCached(alice.URL, &Cached{Twts: types.Twts{first, second, other}})
+
+		query, err := ParseSearchQuery("hello")
+		assert.NoError(err)
+		twts, _, err := cache.Search(archive, query, "", 0)
+		assert.NoError(err)
+		assert.Len(twts, 3)
+
+		assert.Len(cache.GetReplies(archive, hash), 2)
+
+		// Removing one of the twts whose hashes collide keeps the other
+		cache.setCached(alice.URL, &Cached{Twts: types.Twts{first, other}})
+		twts, _, err = cache.Search(archive, query, "", 0)
+		assert.NoError(err)
+		assert.Len(twts, 2)
+		assert.Equal([]string{"Hello 53"}, texts(cache.GetReplies(archive, hash)))
+
+		// Archived twts that are still cached are only returned once
+		cache.archiveTwts(archive, types.Twts{first, second})
+		twts, _, err = cache.Search(archive, query, "", 0)
+		assert.NoError(err)
+		assert.Len(twts, 3)
+		assert.Len(cache.GetReplies(archive, hash), 2)
+	})
+
+	t.Run("UpdateArchived", func(t *testing.T) {
+		assert := assert.New(t)
+
+		archive := make(testArchiver)
+		cache := &Cache{Twts: make(map[string]*Cached)}
+		cache.archiveTwts(archive, types.Twts{first, second})
+		assert.Len(archive[hash], 2)
+
+		cache.UpdateArchived(archive, first, nil)
+
+		twts, err := archive.GetAll(hash)
+		assert.NoError(err)
+		assert.Equal([]string{"Hello 79049"}, texts(twts))
+		assert.True(cache.Archived[hash][hash])
+	})
+
+	t.Run("SelectTwts", func(t *testing.T) {
+		assert := assert.New(t)
+
+		bob := types.Twter{Nick: "bob", URL: "https://example.org/twtxt.txt"}
+		third, err := types.ParseLine("2020-12-01T01:00:00+01:00\tHi", bob)
+		assert.NoError(err)
+
+		twts := types.Twts{first, second, third}
+		assert.Len(selectTwts(twts, "", ""), 3)
+		assert.Len(selectTwts(twts, alice.URL, ""), 2)
+		assert.Len(selectTwts(twts, "", "2020-12-01T00:00:00Z"), 3)
+		assert.Len(selectTwts(twts, bob.URL, "2020-12-01T00:00:00Z"), 1)
+		assert.Empty(selectTwts(twts, bob.URL, "2020-12-01T00:00:01Z"))
+		assert.Empty(selectTwts(twts, "", "yesterday"))
+	})
+}
+
+func texts(twts types.Twts) (res []string) {
+	for _, twt := range twts {
+		res = append(res, twt.Text())
+	}
+	return
+}
@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// feedBackoffMin is the delay before retrying a feed after its first
+	// failure which doubles with every consecutive failure up to feedBackoffMax
+	feedBackoffMin = 5 * time.Minute
+	feedBackoffMax = 24 * time.Hour
+
+	// feedDeadAfter is how long a feed has to have been failing for before
+	// it is considered dead
+	feedDeadAfter = 7 * 24 * time.Hour
+
+	// pollSampleSize is the number of a feed's most recent twts its posting
+	// rate is estimated from
+	pollSampleSize = 10
+)
+
+// FeedHealth records the outcome of fetching a feed so that failing feeds
+// can be backed off and dead feeds shown to the users following them
+type FeedHealth struct {
+	LastAttempt  time.Time
+	LastSuccess  time.Time
+	FailingSince time.Time
+	NextAttempt  time.Time
+
+	// Failures is the number of consecutive failed fetches
+	Failures   int
+	LastStatus int
+	LastError  string
+}
+
+// Failing returns true if the last fetch of the feed failed
+func (h *FeedHealth) Failing() bool {
+	return h.Failures > 0
+}
+
+// sameOutcome returns true if h and other record the same outcome of the
+// last fetch, regardless of when it was made
+func (h *FeedHealth) sameOutcome(other *FeedHealth) bool {
+	return h.Failures == other.Failures &&
+		h.LastStatus == other.LastStatus &&
+		h.LastError == other.LastError &&
+		h.FailingSince.Equal(other.FailingSince)
+}
+
+// Dead returns true if the feed has been failing for at least feedDeadAfter
+func (h *FeedHealth) Dead() bool {
+	return h.Failing() && time.Since(h.FailingSince) >= feedDeadAfter
+}
+
+// feedBackoff returns how long to wait before fetching a feed again after
+// the given number of consecutive failures
+func feedBackoff(failures int) time.Duration {
+	backoff := feedBackoffMin
+	for i := 1; i < failures && backoff < feedBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > feedBackoffMax {
+		backoff = feedBackoffMax
+	}
+	return backoff
+}
+
+// pollInterval returns how long to wait before polling a feed again given its
+// cached twts (newest first). Feeds are polled a few times for every twt they
+// are expected to post, based on their recent posting rate and how long ago
+// they last posted, bounded by the configured Min/MaxFetchInterval.
+func pollInterval(conf *Config, twts types.Twts) time.Duration {
+	interval := conf.MaxFetchInterval
+
+	if len(twts) > 0 {
+		newest := twts[0].Created()
+
+		// A feed that has gone quiet is polled less often the longer it stays so
+		interval = time.Since(newest)
+
+		if n := len(twts); n > 1 {
+			if n > pollSampleSize {
+				n = pollSampleSize
+			}
+			gap := newest.Sub(twts[n-1].Created()) / time.Duration(n-1)
+			if gap > interval {
+				interval = gap
+			}
+		}
+
+		interval /= 4
+	}
+
+	if conf.MaxFetchInterval > 0 && interval > conf.MaxFetchInterval {
+		interval = conf.MaxFetchInterval
+	}
+	if interval < conf.MinFetchInterval {
+		interval = conf.MinFetchInterval
+	}
+
+	return interval
+}
+
+// GetHealth returns a copy of the health of the feed url or nil if the feed
+// has not been fetched yet
+func (cache *Cache) GetHealth(url string) *FeedHealth {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	health, ok := cache.Health[url]
+	if !ok {
+		return nil
+	}
+	h := *health
+	return &h
+}
+
+// isDue returns true if the feed url is due to be polled again, that is it
+// has never been fetched or its poll interval or backoff has elapsed
+func (cache *Cache) isDue(url string) bool {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	health, ok := cache.Health[url]
+	if !ok {
+		return true
+	}
+	return !time.Now().Before(health.NextAttempt)
+}
+
+// recordFetch updates the health of the feed url with the outcome of a fetch
+// and schedules its next poll. A nil err with a status of 200, 206 or 304 is
+// a success, anything else a failure which is backed off. The health is only
+// persisted again when the outcome changes so that polling a feed that keeps
+// being fetched the same way is not written on every Store.
+func (cache *Cache) recordFetch(conf *Config, url string, status int, err error) {
+	switch status {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+	default:
+		if err == nil {
+			err = fmt.Errorf("unexpected response: %d %s", status, http.StatusText(status))
+		}
+	}
+
+	now := time.Now()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.Health == nil {
+		cache.Health = make(map[string]*FeedHealth)
+	}
+
+	health, ok := cache.Health[url]
+	if !ok {
+		health = &FeedHealth{}
+		cache.Health[url] = health
+	}
+
+	prev := *health
+
+	health.LastAttempt = now
+	health.LastStatus = status
+
+	if err == nil {
+		health.LastSuccess = now
+		health.FailingSince = time.Time{}
+		health.Failures = 0
+		health.LastError = ""
+
+		var twts types.Twts
+		if cached, ok := cache.Twts[url]; ok {
+			twts = cached.Twts
+		}
+		health.NextAttempt = now.Add(pollInterval(conf, twts))
+	} else {
+		if health.Failures == 0 {
+			health.FailingSince = now
+		}
+		health.Failures++
+		health.LastError = err.Error()
+		health.NextAttempt = now.Add(feedBackoff(health.Failures))
+	}
+
+	if !ok || !health.sameOutcome(&prev) {
+		cache.markStateDirty(url)
+	}
+}
@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+var (
+	ErrFeedArchiveMismatch = errors.New("error: archive file does not have the twt its feed declares")
+)
+
+// maxHistoryFetches is the most archive files of a feed fetched on demand to
+// fill a single page of the feed's twts
+const maxHistoryFetches = 3
+
+// FeedHistory records how much of a feed's history, split into archive files
+// linked by `# prev` headers (see types.Metadata), has been fetched into the
+// Archiver
+type FeedHistory struct {
+	// Prevs maps the url of each archive file fetched to the archive file it
+	// declares before it or nil if it is the oldest
+	Prevs map[string]*types.FeedArchive
+
+	// Twts maps the twts fetched from the archive files (keyed by twtKey) to
+	// their hashes. The key tells the twt apart from any archived twts whose
+	// hashes collide with it.
+	Twts map[string]string
+}
+
+// next returns the next archive file to fetch by following the chain of
+// archive files from the feed's most recent (head) past those already
+// fetched, or nil if all of them have been
+func (h *FeedHistory) next(head *types.FeedArchive) *types.FeedArchive {
+	if h == nil {
+		return head
+	}
+
+	prev := head
+	// Guard against archive files that (eventually) point back at themselves
+	for i := 0; prev != nil && i <= len(h.Prevs); i++ {
+		p, ok := h.Prevs[prev.URL]
+		if !ok {
+			return prev
+		}
+		prev = p
+	}
+	return nil
+}
+
+// copy returns a copy of h that does not share its Prevs or Twts, or nil if
+// h is nil
+func (h *FeedHistory) copy() *FeedHistory {
+	if h == nil {
+		return nil
+	}
+
+	c := &FeedHistory{
+		Prevs: make(map[string]*types.FeedArchive, len(h.Prevs)),
+		Twts:  make(map[string]string, len(h.Twts)),
+	}
+	for url, prev := range h.Prevs {
+		c.Prevs[url] = prev
+	}
+	for key, hash := range h.Twts {
+		c.Twts[key] = hash
+	}
+	return c
+}
+
+// hasHash returns true if any of twts has the hash hash
+func hasHash(twts types.Twts, hash string) bool {
+	for _, twt := range twts {
+		if twt.Hash() == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveFeedArchive resolves the url of the archive file prev relative to
+// the url of the feed (or archive file) that declares it
+func resolveFeedArchive(base string, prev *types.FeedArchive) (*types.FeedArchive, error) {
+	if prev == nil {
+		return nil, nil
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := u.Parse(prev.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.FeedArchive{Hash: prev.Hash, URL: resolved.String()}, nil
+}
+
+// feedHead returns the most recent archive file of the feed url declared by
+// the feed's metadata, must be called with the cache locked
+func (cache *Cache) feedHead(url string) *types.FeedArchive {
+	cached, ok := cache.Twts[url]
+	if !ok || cached.Metadata == nil {
+		return nil
+	}
+
+	head, err := resolveFeedArchive(url, cached.Metadata.Prev)
+	if err != nil {
+		log.WithError(err).Warnf("error resolving prev of feed %s", url)
+		return nil
+	}
+	return head
+}
+
+// HasHistory returns true if the feed url has archive files that have not
+// been fetched yet
+func (cache *Cache) HasHistory(url string) bool {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	return cache.History[url].next(cache.feedHead(url)) != nil
+}
+
+// FetchHistory fetches the next archive file of the feed's history (if any)
+// into the archive and returns the number of twts archived. The archive file
+// is only archived if it has the twt whose hash the `# prev` header pointing
+// at it declares.
+func (cache *Cache) FetchHistory(conf *Config, archive Archiver, feed types.Feed) (int, error) {
+	cache.mu.RLock()
+	next := cache.History[feed.URL].next(cache.feedHead(feed.URL))
+	twter := types.Twter{Nick: feed.Nick, URL: feed.URL}
+	if cached, ok := cache.Twts[feed.URL]; ok && len(cached.Twts) > 0 {
+		twter = cached.Twts[0].Twter()
+	}
+	cache.mu.RUnlock()
+
+	if next == nil {
+		return 0, nil
+	}
+
+	res, err := Request(conf, http.MethodGet, next.URL, nil)
+	if err != nil {
+		log.WithError(err).Errorf("error fetching archive file %s of %s", next.URL, feed)
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error: unexpected response fetching archive file %s: %s", next.URL, res.Status)
+	}
+
+	limitedReader := &io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit}
+	twts, _, meta, err := types.ParseFile(limitedReader, twter, 0, 0)
+	if err != nil {
+		log.WithError(err).Errorf("error parsing archive file %s of %s", next.URL, feed)
+		return 0, err
+	}
+
+	// The archive file must be the one declared, whose newest twt has the
+	// declared hash, or it could be some other feed's (or a stale) file
+	if !hasHash(twts, next.Hash) {
+		log.Warnf("archive file %s of %s does not have twt %s", next.URL, feed, next.Hash)
+		return 0, ErrFeedArchiveMismatch
+	}
+
+	prev, err := resolveFeedArchive(next.URL, meta.Prev)
+	if err != nil {
+		log.WithError(err).Warnf("error resolving prev of archive file %s", next.URL)
+	}
+
+	archived := cache.archiveTwts(archive, twts)
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.History == nil {
+		cache.History = make(map[string]*FeedHistory)
+	}
+	history, ok := cache.History[feed.URL]
+	if !ok {
+		history = &FeedHistory{}
+		cache.History[feed.URL] = history
+	}
+	if history.Prevs == nil {
+		history.Prevs = make(map[string]*types.FeedArchive)
+	}
+	if history.Twts == nil {
+		history.Twts = make(map[string]string)
+	}
+
+	for _, twt := range archived {
+		history.Twts[twtKey(twt)] = twt.Hash()
+	}
+	history.Prevs[next.URL] = prev
+
+	cache.markStateDirty(feed.URL)
+
+	return len(archived), nil
+}
+
+// GetHistory returns the twts (newest first) of the feed url fetched from its
+// archive files that are no longer in the cache
+func (cache *Cache) GetHistory(archive Archiver, url string) types.Twts {
+	cache.mu.RLock()
+	keys := make(map[string]string)
+	if history, ok := cache.History[url]; ok {
+		for key, hash := range history.Twts {
+			keys[key] = hash
+		}
+	}
+	if c, ok := cache.Twts[url]; ok {
+		for _, twt := range c.Twts {
+			delete(keys, twtKey(twt))
+		}
+	}
+	cache.mu.RUnlock()
+
+	var twts types.Twts
+	for key, hash := range keys {
+		candidates, err := archive.GetAll(hash)
+		if err != nil {
+			log.WithError(err).Warnf("error loading archived twt %s", hash)
+			continue
+		}
+		// Other feeds' twts may have the same hash
+		for _, twt := range candidates {
+			if twtKey(twt) == key {
+				twts = append(twts, twt)
+				break
+			}
+		}
+	}
+	sort.Sort(twts)
+
+	return twts
+}
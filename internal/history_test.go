@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestCache_FetchHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	retwt.DefaultTwtManager()
+
+	files := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	conf := NewConfig()
+	conf.MaxFetchLimit = DefaultMaxFetchLimit
+	archive := make(testArchiver)
+	feed := types.Feed{Nick: "alice", URL: server.URL + "/twtxt.txt"}
+
+	hash := func(line string) string {
+		twt, err := types.ParseLine(line, types.Twter{Nick: feed.Nick, URL: feed.URL})
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+		return twt.Hash()
+	}
+
+	files["/archive/2.txt"] = "# prev = " + hash("2020-10-01T00:00:00Z\tSeptember") + " 1.txt\n" +
+		"2020-11-01T00:00:00Z\tOctober\n" +
+		"2020-11-02T00:00:00Z\tNovember\n"
+	// Points back at the most recent archive file
+	files["/archive/1.txt"] = "# prev = " + hash("2020-11-02T00:00:00Z\tNovember") + " /archive/2.txt\n" +
+		"2020-10-01T00:00:00Z\tSeptember\n"
+	// Does not have the twt the feed declares
+	files["/archive/0.txt"] = "2020-09-01T00:00:00Z\tAugust\n"
+
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	assert.False(cache.HasHistory(feed.URL))
+
+	cache.Twts[feed.URL] = &Cached{
+		Metadata: &types.Metadata{Prev: &types.FeedArchive{Hash: hash("2020-11-02T00:00:00Z\tNovember"), URL: "archive/0.txt"}},
+	}
+	assert.True(cache.HasHistory(feed.URL))
+
+	n, err := cache.FetchHistory(conf, archive, feed)
+	assert.Equal(ErrFeedArchiveMismatch, err)
+	assert.Zero(n)
+	assert.Empty(archive)
+
+	cache.Twts[feed.URL].Metadata.Prev.URL = "archive/2.txt"
+
+	n, err = cache.FetchHistory(conf, archive, feed)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	assert.True(cache.HasHistory(feed.URL))
+
+	n, err = cache.FetchHistory(conf, archive, feed)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.False(cache.HasHistory(feed.URL))
+
+	n, err = cache.FetchHistory(conf, archive, feed)
+	assert.NoError(err)
+	assert.Equal(0, n)
+
+	var texts []string
+	for _, twt := range cache.GetHistory(archive, feed.URL) {
+		assert.Equal("alice", twt.Twter().Nick)
+		texts = append(texts, twt.Text())
+	}
+	assert.Equal([]string{"November", "October", "September"}, texts)
+	assert.Len(archive, 3)
+
+	// Another feed's twt whose hash collides with one of the feed's is not
+	// mistaken for it
+	october := hash("2020-11-01T00:00:00Z\tOctober")
+	other, err := types.ParseLine("2020-11-01T00:00:00Z\tOctober", types.Twter{Nick: "bob", URL: server.URL + "/bob.txt"})
+	assert.NoError(err)
+	archive[october] = append(types.Twts{other}, archive[october]...)
+
+	texts = nil
+	for _, twt := range cache.GetHistory(archive, feed.URL) {
+		assert.Equal("alice", twt.Twter().Nick)
+		texts = append(texts, twt.Text())
+	}
+	assert.Equal([]string{"November", "October", "September"}, texts)
+}
@@ -2,8 +2,6 @@ package internal
 
 import (
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
 
 	"github.com/jointwt/twtxt/types"
 	"github.com/robfig/cron"
@@ -31,22 +29,16 @@ func init() {
 		"UpdateFeeds":       NewJobSpec("@every 5m", NewUpdateFeedsJob),
 		"UpdateFeedSources": NewJobSpec("@every 15m", NewUpdateFeedSourcesJob),
 
-		"FixUserAccounts":   NewJobSpec("@hourly", NewFixUserAccountsJob),
 		"DeleteOldSessions": NewJobSpec("@hourly", NewDeleteOldSessionsJob),
+		"RotateFeeds":       NewJobSpec("@hourly", NewRotateFeedsJob),
 
-		"FixMissingTwts": NewJobSpec("@daily", NewFixMissingTwtsJob),
-		"Stats":          NewJobSpec("@daily", NewStatsJob),
-
-		"FixFollowers": NewJobSpec("", NewFixFollowersJob),
+		"Stats": NewJobSpec("@daily", NewStatsJob),
 	}
 
 	StartupJobs = map[string]JobSpec{
 		"UpdateFeeds":       Jobs["UpdateFeeds"],
 		"UpdateFeedSources": Jobs["UpdateFeedSources"],
-		"FixUserAccounts":   Jobs["FixUserAccounts"],
-		"FixMissingTwts":    Jobs["FixMissingTwts"],
 		"DeleteOldSessions": Jobs["DeleteOldSessions"],
-		"FixFollowers":      Jobs["FixFollowers"],
 	}
 }
 
@@ -143,7 +135,7 @@ func (job *StatsJob) Run() {
 		archiveSize, job.cache.Count(), len(followers), len(following),
 	)
 
-	if _, err := AppendSpecial(job.conf, job.db, "stats", text); err != nil {
+	if _, err := AppendSpecial(job.conf, job.cache.feedWriter, job.db, "stats", text); err != nil {
 		log.WithError(err).Warn("error updating stats feed")
 	}
 }
@@ -200,9 +192,23 @@ func (job *UpdateFeedsJob) Run() {
 		}
 	}
 
+	// Each feed is polled on its own interval, see recordFetch()
+	for feed := range sources {
+		if !job.cache.isDue(feed.URL) {
+			delete(sources, feed)
+		}
+	}
+
 	log.Infof("updating %d sources", len(sources))
 	job.cache.FetchTwts(job.conf, job.archive, sources, followers)
 
+	// Feeds that failed to move are moved again on their next fetch
+	for from, to := range job.cache.FeedMoves() {
+		if err := MoveFeed(job.conf, job.cache.feedWriter, job.db, from, to); err != nil {
+			log.WithError(err).Warnf("error moving feed %s to %s", from, to)
+		}
+	}
+
 	log.Infof("warming cache with local twts for %s", job.conf.BaseURL)
 	job.cache.GetByPrefix(job.conf.BaseURL, true)
 
@@ -245,93 +251,6 @@ func (job *UpdateFeedSourcesJob) Run() {
 	}
 }
 
-type FixUserAccountsJob struct {
-	conf    *Config
-	blogs   *BlogsCache
-	cache   *Cache
-	archive Archiver
-	db      Store
-}
-
-func NewFixUserAccountsJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
-	return &FixUserAccountsJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
-}
-
-func (job *FixUserAccountsJob) Run() {
-	// TODO: Refactor this into its own job.
-	fixAdminUser := func() error {
-		log.Infof("fixing adminUser account %s", job.conf.AdminUser)
-		adminUser, err := job.db.GetUser(job.conf.AdminUser)
-		if err != nil {
-			log.WithError(err).Warnf("error loading user object for AdminUser")
-			return err
-		}
-
-		for _, feed := range specialUsernames {
-			if err := CreateFeed(job.conf, job.db, adminUser, feed, true); err != nil {
-				log.WithError(err).Warnf("error creating new feed %s for adminUser", feed)
-			}
-		}
-
-		if err := job.db.SetUser(adminUser.Username, adminUser); err != nil {
-			log.WithError(err).Warn("error saving user object for AdminUser")
-			return err
-		}
-
-		return nil
-	}
-
-	// Fix/Update the adminUser account
-	if err := fixAdminUser(); err != nil {
-		log.WithError(err).Warnf("error fixing adminUser %s", job.conf.AdminUser)
-	}
-
-	// Create twtxtBots feeds
-	for _, feed := range twtxtBots {
-		if err := CreateFeed(job.conf, job.db, nil, feed, true); err != nil {
-			log.WithError(err).Warnf("error creating new feed %s", feed)
-		}
-	}
-}
-
-type FixMissingTwtsJob struct {
-	conf    *Config
-	blogs   *BlogsCache
-	cache   *Cache
-	archive Archiver
-	db      Store
-}
-
-func NewFixMissingTwtsJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
-	return &FixMissingTwtsJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
-}
-
-func (job *FixMissingTwtsJob) Run() {
-	p := filepath.Join(job.conf.Data, feedsDir)
-	fileInfos, err := ioutil.ReadDir(p)
-	if err != nil {
-		log.WithError(err).Error("error reading feeds")
-		return
-	}
-
-	for _, fileInfo := range fileInfos {
-		name := fileInfo.Name()
-		twts, err := GetAllTwts(job.conf, name)
-		if err != nil {
-			log.WithError(err).Errorf("error loading twts for %s", name)
-			continue
-		}
-
-		for _, twt := range twts {
-			_, ok := job.cache.Lookup(twt.Hash())
-			if !ok && !job.archive.Has(twt.Hash()) {
-				log.Infof("inserting missing Twt %s into archive", twt.Hash())
-				_ = job.archive.Archive(twt)
-			}
-		}
-	}
-}
-
 type DeleteOldSessionsJob struct {
 	conf    *Config
 	blogs   *BlogsCache
@@ -363,7 +282,7 @@ func (job *DeleteOldSessionsJob) Run() {
 	}
 }
 
-type FixFollowersJob struct {
+type RotateFeedsJob struct {
 	conf    *Config
 	blogs   *BlogsCache
 	cache   *Cache
@@ -371,50 +290,46 @@ type FixFollowersJob struct {
 	db      Store
 }
 
-func NewFixFollowersJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
-	return &FixFollowersJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
+func NewRotateFeedsJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
+	return &RotateFeedsJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
 }
 
-func (job *FixFollowersJob) Run() {
-	log.Infof("fixing followers")
-
-	feeds, err := job.db.GetAllFeeds()
-	if err != nil {
-		log.WithError(err).Warn("unable to get all feeds from database")
+func (job *RotateFeedsJob) Run() {
+	if job.conf.FeedRotateAge == 0 && job.conf.FeedRotateSize == 0 {
 		return
 	}
 
-	users, err := job.db.GetAllUsers()
+	names, err := GetAllFeeds(job.conf)
 	if err != nil {
-		log.WithError(err).Warn("unable to get all users from database")
+		log.WithError(err).Warn("unable to get all local feeds")
 		return
 	}
 
-	for _, followee := range feeds {
-		for _, follower := range users {
-			if follower.Follows(followee.URL) && !followee.FollowedBy(follower.URL) {
-				log.Infof("%s follows feed %s but not listed in .Followers", follower.Username, followee.Name)
-				followee.Followers[follower.Username] = follower.URL
-			}
-		}
-		if err := job.db.SetFeed(followee.Name, followee); err != nil {
-			log.WithError(err).Error("error updating followee")
+	sources := make(types.Feeds)
+
+	for _, name := range names {
+		if isSnapshotTemp(name) {
+			continue
 		}
-	}
 
-	for _, followee := range users {
-		for _, follower := range users {
-			if follower.Follows(followee.URL) && !followee.FollowedBy(follower.URL) {
-				log.Infof("%s follows user %s but not listed in .Followers", follower.Username, followee.Username)
-				followee.Followers[follower.Username] = follower.URL
-			}
+		twts, err := RotateFeed(job.conf, job.cache.feedWriter, name)
+		if err != nil {
+			log.WithError(err).Warnf("error rotating feed %s", name)
+			continue
 		}
-		if err := job.db.SetUser(followee.Username, followee); err != nil {
-			log.WithError(err).Error("error updating followee")
+		if len(twts) == 0 {
+			continue
 		}
+
+		log.Infof("rotated %d twts out of feed %s", len(twts), name)
+
+		// Rotated twts are archived so permalinks and conversations keep
+		// resolving them once they are gone from the cache
+		job.cache.archiveTwts(job.archive, twts)
+		sources[types.Feed{Nick: name, URL: URLForUser(job.conf, name)}] = true
 	}
 
-	if err := job.db.Sync(); err != nil {
-		log.WithError(err).Error("error syncing store")
+	if len(sources) > 0 {
+		job.cache.FetchTwts(job.conf, job.archive, sources, nil)
 	}
 }
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+var (
+	ErrLintAddressNotAllowed = errors.New("error: refusing to lint a feed on a loopback, private or link-local address")
+	ErrLintTooManyRedirects  = errors.New("error: too many redirects linting feed")
+)
+
+// lintMaxRedirects is the most redirects followed fetching a feed to lint
+const lintMaxRedirects = 10
+
+// lintDeniedNets are the networks (besides loopback, link-local, multicast
+// and unspecified addresses) LintFeed refuses to fetch feeds from
+var lintDeniedNets = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"fc00::/7",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isLintableIP returns true if ip is a public address LintFeed may fetch from
+func isLintableIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range lintDeniedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkLintHost resolves the host of u and fails if any of its addresses
+// are not ones LintFeed may fetch from
+func checkLintHost(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("error: unsupported scheme %q linting feed", u.Scheme)
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !isLintableIP(addr.IP) {
+			return ErrLintAddressNotAllowed
+		}
+	}
+	return nil
+}
+
+// lintClient returns a client that refuses to connect to, or be redirected
+// to, addresses LintFeed may not fetch from. The address is checked again
+// as it is dialed so a host resolving differently the second time is caught.
+func lintClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isLintableIP(ip) {
+				return ErrLintAddressNotAllowed
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: requestTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= lintMaxRedirects {
+				return ErrLintTooManyRedirects
+			}
+			return checkLintHost(req.Context(), req.URL)
+		},
+	}
+}
+
+// LintFeed fetches the feed at uri and strictly validates it (see
+// types.LintFile). Only feeds on public addresses are fetched and the text
+// of the lines with problems is left out of the report so linting cannot be
+// used to read other services through the pod.
+func LintFeed(conf *Config, uri string) (*types.LintReport, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLintHost(context.Background(), u); err != nil {
+		log.WithError(err).Warnf("refusing to lint feed %s", uri)
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent(conf))
+
+	res, err := lintClient().Do(req)
+	if err != nil {
+		log.WithError(err).Errorf("error fetching feed %s to lint", uri)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error: unexpected response fetching feed %s: %s", uri, res.Status)
+	}
+
+	limitedReader := &io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit}
+	report, err := types.LintFile(limitedReader, types.Twter{URL: uri})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report.Errors {
+		report.Errors[i].Text = ""
+	}
+
+	if n, _ := io.ReadFull(res.Body, make([]byte, 1)); n > 0 {
+		report.Errors = append(report.Errors, types.LintError{
+			Message: fmt.Sprintf("feed is larger than the %d bytes fetched of it, the rest is ignored", conf.MaxFetchLimit),
+		})
+	}
+
+	return report, nil
+}
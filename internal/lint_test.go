@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsLintableIP(t *testing.T) {
+	testCases := []struct {
+		ip       string
+		expected bool
+	}{
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.ip, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, isLintableIP(net.ParseIP(testCase.ip)))
+		})
+	}
+}
+
+func TestLintFeed(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("secret\n"))
+	}))
+	defer ts.Close()
+
+	conf := NewConfig()
+	conf.MaxFetchLimit = DefaultMaxFetchLimit
+
+	t.Run("RefusesLoopback", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := LintFeed(conf, ts.URL+"/twtxt.txt")
+		assert.Equal(ErrLintAddressNotAllowed, err)
+		assert.Equal(0, requests)
+	})
+
+	t.Run("RefusesUnsupportedScheme", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := LintFeed(conf, "file:///etc/passwd")
+		assert.Error(err)
+	})
+
+	t.Run("RefusesDialingLoopback", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// A host that passed checkLintHost but resolves (or redirects) to a
+		// loopback address is refused as it is dialed
+		_, err := lintClient().Get(ts.URL + "/twtxt.txt")
+		assert.Error(err)
+		assert.Equal(0, requests)
+	})
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+// localFeedName returns the name of the local feed that url is the url of
+// (see URLForUser) or false if url is not the url of a feed on this pod
+func localFeedName(conf *Config, url string) (string, bool) {
+	prefix := strings.TrimSuffix(NormalizeURL(conf.BaseURL), "/") + "/user/"
+
+	url = NormalizeURL(url)
+	if !strings.HasPrefix(url, prefix) || !strings.HasSuffix(url, "/twtxt.txt") {
+		return "", false
+	}
+
+	name := NormalizeUsername(strings.TrimSuffix(strings.TrimPrefix(url, prefix), "/twtxt.txt"))
+	if name == "" || strings.ContainsAny(name, "/\\") || name[0] == '.' {
+		return "", false
+	}
+
+	return name, true
+}
+
+// feedETag returns the ETag a local feed with the header header and the
+// content hash (see FeedWriter.Hash) is served with. It is a strong validator
+// of the bytes served so clients can make range requests conditional on it
+// with If-Range as well as poll the feed with If-None-Match.
+func feedETag(header, hash string) string {
+	return fmt.Sprintf(`"%s"`, FastHash(header + hash)[:32])
+}
+
+// localFeedURL returns the url the local feed name is cached under, the same
+// however the feed is followed or loaded
+func localFeedURL(conf *Config, name string) string {
+	return NormalizeURL(URLForUser(conf, name))
+}
+
+// LoadFeed loads the twts of the local feed name straight from disk into the
+// cache (see localFeedURL) and returns them. The feed is only parsed again
+// once it has been written since it was last loaded.
+func (cache *Cache) LoadFeed(conf *Config, archive Archiver, name string) types.Twts {
+	url := localFeedURL(conf, name)
+
+	f, fileInfo, err := cache.feedWriter.Open(filepath.Join(conf.Data, feedsDir, name))
+	if err != nil {
+		log.WithError(err).Errorf("error opening local feed %s", name)
+		if os.IsNotExist(err) {
+			cache.recordFetch(conf, url, http.StatusNotFound, err)
+		} else {
+			cache.recordFetch(conf, url, 0, err)
+		}
+		return nil
+	}
+	defer f.Close()
+
+	// The hash of the feed's content is cached until it is written
+	etag, err := cache.feedWriter.Hash(f.Name(), f, fileInfo)
+	if err != nil {
+		log.WithError(err).Errorf("error hashing local feed %s", name)
+		cache.recordFetch(conf, url, 0, err)
+		return nil
+	}
+
+	cache.mu.RLock()
+	prev, ok := cache.Twts[url]
+	cache.mu.RUnlock()
+
+	if ok && prev.ETag == etag {
+		cache.recordFetch(conf, url, http.StatusNotModified, nil)
+		return prev.Twts
+	}
+
+	twter := types.Twter{
+		Nick:   name,
+		URL:    URLForUser(conf, name),
+		Avatar: URLForAvatar(conf, name),
+	}
+	body := io.NewSectionReader(f, 0, fileInfo.Size())
+	twts, old, meta, err := types.ParseFile(body, twter, conf.MaxCacheTTL, conf.MaxCacheItems)
+	if err != nil {
+		log.WithError(err).Errorf("error parsing local feed %s", name)
+		cache.recordFetch(conf, url, 0, err)
+		return nil
+	}
+
+	cache.archiveTwts(archive, old)
+
+	cache.mu.Lock()
+	// The feed may have been loaded again since it was checked above, never
+	// replace what was loaded from a newer version of it
+	if cur, ok := cache.Twts[url]; ok && (cur.ETag == etag || cur.modTime.After(fileInfo.ModTime())) {
+		cache.mu.Unlock()
+		cache.recordFetch(conf, url, http.StatusNotModified, nil)
+		return cur.Twts
+	}
+	cache.setCached(url, &Cached{
+		cache:    make(map[string]types.Twt),
+		Twts:     twts,
+		ETag:     etag,
+		Metadata: meta,
+		modTime:  fileInfo.ModTime(),
+	})
+	cache.mu.Unlock()
+
+	cache.recordFetch(conf, url, http.StatusOK, nil)
+
+	return twts
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestLocalFeedName(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := NewConfig()
+	conf.BaseURL = "https://twtxt.example.com"
+
+	name, ok := localFeedName(conf, "https://twtxt.example.com/user/alice/twtxt.txt")
+	assert.True(ok)
+	assert.Equal("alice", name)
+
+	name, ok = localFeedName(conf, "https://twtxt.example.com:443/user/Alice/twtxt.txt")
+	assert.True(ok)
+	assert.Equal("alice", name)
+
+	for _, url := range []string{
+		"https://example.com/user/alice/twtxt.txt",
+		"https://twtxt.example.com/user/alice/archive/twtxt-2020-12-01.txt",
+		"https://twtxt.example.com/user/../twtxt.txt",
+		"https://twtxt.example.com/external/bob/twtxt.txt",
+		"https://twtxt.example.com/twtxt.txt",
+	} {
+		_, ok := localFeedName(conf, url)
+		assert.False(ok, url)
+	}
+}
+
+func TestCache_LoadFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	retwt.DefaultTwtManager()
+
+	data, err := ioutil.TempDir("", "twtxt-local-*")
+	assert.NoError(err)
+	defer os.RemoveAll(data)
+	assert.NoError(os.MkdirAll(filepath.Join(data, feedsDir), 0755))
+
+	conf := NewConfig()
+	conf.Data = data
+	conf.BaseURL = "http://0.0.0.0:8000"
+
+	now := time.Now().UTC()
+	line := func(age time.Duration, text string) string {
+		return now.Add(-age).Format(time.RFC3339) + "\t" + text + "\n"
+	}
+
+	fn := filepath.Join(data, feedsDir, "alice")
+	assert.NoError(ioutil.WriteFile(fn, []byte(line(time.Hour, "Hello")), 0644))
+
+	archive := make(testArchiver)
+	cache := &Cache{Twts: make(map[string]*Cached), feedWriter: NewFeedWriter()}
+	url := URLForUser(conf, "alice")
+
+	twts := cache.LoadFeed(conf, archive, "alice")
+	assert.Len(twts, 1)
+	assert.Equal("alice", twts[0].Twter().Nick)
+	assert.Equal(url, twts[0].Twter().URL)
+	assert.Equal(http.StatusOK, cache.Health[url].LastStatus)
+
+	// Unchanged feeds are not parsed again
+	cached := cache.Twts[url]
+	assert.Equal(cached.Twts, cache.LoadFeed(conf, archive, "alice"))
+	assert.True(cached == cache.Twts[url])
+
+	assert.NoError(cache.feedWriter.Append(fn, []byte(line(time.Minute, "World"))))
+	assert.Len(cache.LoadFeed(conf, archive, "alice"), 2)
+	assert.Len(cache.GetByPrefix(conf.BaseURL, true), 2)
+
+	// A load of an older version of the feed that loses a race with a load
+	// of a newer one does not replace it
+	newer := &Cached{Twts: cache.Twts[url].Twts[:1], ETag: `"newer"`, modTime: now.Add(time.Hour)}
+	cache.mu.Lock()
+	cache.setCached(url, newer)
+	cache.mu.Unlock()
+	assert.Len(cache.LoadFeed(conf, archive, "alice"), 1)
+	assert.True(newer == cache.Twts[url])
+
+	assert.Nil(cache.LoadFeed(conf, archive, "bob"))
+	assert.Equal(1, cache.Health[URLForUser(conf, "bob")].Failures)
+
+	// The feed is cached under the one url however it is followed
+	cache.FetchTwts(conf, archive, types.Feeds{
+		types.Feed{Nick: "alice", URL: url}:                                       true,
+		types.Feed{Nick: "Alice", URL: "http://0.0.0.0:80/user/Alice/twtxt.txt/"}: true,
+	}, nil)
+	var urls []string
+	for u := range cache.Twts {
+		urls = append(urls, u)
+	}
+	assert.Equal([]string{url}, urls)
+}
+
+func TestFeedETag(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "twtxt-etag-*")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	w := NewFeedWriter()
+	fn := filepath.Join(dir, "alice")
+	assert.NoError(w.Append(fn, []byte("2020-12-01T00:00:00Z\tHello World!\n")))
+
+	open := func() (*os.File, os.FileInfo, string) {
+		f, fileInfo, err := w.Open(fn)
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+		hash, err := w.Hash(fn, f, fileInfo)
+		assert.NoError(err)
+		return f, fileInfo, hash
+	}
+
+	f, fileInfo, hash := open()
+	defer f.Close()
+
+	etag := feedETag("# nick = alice\n#\n", hash)
+	assert.False(strings.HasPrefix(etag, `W/`))
+	assert.NotEqual(etag, feedETag("# nick = bob\n#\n", hash))
+
+	// The hash is cached until the feed is written
+	cached, err := w.Hash(fn, strings.NewReader(""), fileInfo)
+	assert.NoError(err)
+	assert.Equal(hash, cached)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Etag", etag)
+		http.ServeContent(w, r, "twtxt.txt", fileInfo.ModTime(), io.NewSectionReader(f, 0, fileInfo.Size()))
+	}))
+	defer server.Close()
+
+	request := func(headers map[string]string) int {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		assert.NoError(err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(http.StatusNotModified, request(map[string]string{"If-None-Match": etag}))
+	assert.Equal(http.StatusOK, request(map[string]string{"If-None-Match": `"other"`}))
+	assert.Equal(http.StatusPartialContent, request(map[string]string{"Range": "bytes=10-", "If-Range": etag}))
+	assert.Equal(http.StatusOK, request(map[string]string{"Range": "bytes=10-", "If-Range": `"other"`}))
+
+	// An edit that leaves the feed the same size changes the ETag
+	assert.NoError(w.Replace(fn, []byte("2020-12-01T00:00:00Z\tHello Earth!\n")))
+	g, _, edited := open()
+	defer g.Close()
+	assert.NotEqual(etag, feedETag("# nick = alice\n#\n", edited))
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Metrics the code under test updates that the server otherwise
+	// registers in setupMetrics()
+	metrics.NewCounter(
+		"archive", "size",
+		"Number of items inserted into the global feed archive",
+	)
+	metrics.NewCounter(
+		"archive", "error",
+		"Number of items errored inserting into the global feed archive",
+	)
+
+	metrics.NewGauge(
+		"cache", "sources",
+		"Number of feed sources being fetched by the global feed cache",
+	)
+	metrics.NewGauge(
+		"cache", "feeds",
+		"Number of unique feeds in the global feed cache",
+	)
+	metrics.NewGauge(
+		"cache", "twts",
+		"Number of active twts in the global feed cache",
+	)
+	metrics.NewGauge(
+		"cache", "last_processed_seconds",
+		"Number of seconds for a feed cache cycle",
+	)
+
+	os.Exit(m.Run())
+}
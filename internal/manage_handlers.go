@@ -318,6 +318,11 @@ func (s *Server) DelUserHandler() httprouter.Handle {
 					}
 				}
 
+				// Delete feed's archive files
+				if err := os.RemoveAll(filepath.Join(s.config.Data, archivedFeedsDir, nick)); err != nil {
+					log.WithError(err).Error("error removing feed's archive files")
+				}
+
 				// Delete feed from cache
 				s.cache.Delete(feed.Source())
 			}
@@ -389,6 +394,11 @@ func (s *Server) DelUserHandler() httprouter.Handle {
 			}
 		}
 
+		// Delete user's archive files
+		if err := os.RemoveAll(filepath.Join(s.config.Data, archivedFeedsDir, user.Username)); err != nil {
+			log.WithError(err).Error("error removing user's archive files")
+		}
+
 		// Delete user
 		if err := s.db.DelUser(user.Username); err != nil {
 			ctx.Error = true
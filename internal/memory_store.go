@@ -0,0 +1,380 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jointwt/twtxt/internal/session"
+)
+
+// MemoryStore is a Store that keeps everything in memory and never touches
+// disk. It is intended for tests and throw-away demo pods.
+//
+// Records are held in their serialized form (just like the on-disk stores)
+// so that callers mutating a returned object do not change the stored copy.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	feeds    map[string][]byte
+	users    map[string][]byte
+	sessions map[string][]byte
+	tokens   map[string][]byte
+
+	schemaVersion int
+}
+
+func newMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		feeds:    make(map[string][]byte),
+		users:    make(map[string][]byte),
+		sessions: make(map[string][]byte),
+		tokens:   make(map[string][]byte),
+	}
+}
+
+// searchKeys returns the sorted keys of m that start with prefix, the match
+// is case-sensitive like the other stores
+func searchKeys(m map[string][]byte, prefix string) []string {
+	var keys []string
+
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Sync ...
+func (ms *MemoryStore) Sync() error {
+	return nil
+}
+
+// Close ...
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+// Merge ...
+func (ms *MemoryStore) Merge() error {
+	return nil
+}
+
+// GetSchemaVersion ...
+func (ms *MemoryStore) GetSchemaVersion() (int, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.schemaVersion, nil
+}
+
+// SetSchemaVersion ...
+func (ms *MemoryStore) SetSchemaVersion(version int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.schemaVersion = version
+	return nil
+}
+
+// Commit applies the batch while holding the store's lock
+func (ms *MemoryStore) Commit(batch *Batch) error {
+	if err := batch.validate(); err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, op := range batch.Ops {
+		var m map[string][]byte
+		switch op.Kind {
+		case batchFeeds:
+			m = ms.feeds
+		case batchUsers:
+			m = ms.users
+		case batchTokens:
+			m = ms.tokens
+		}
+
+		if op.Data == nil {
+			delete(m, op.Key)
+		} else {
+			m[op.Key] = op.Data
+		}
+	}
+
+	return nil
+}
+
+func (ms *MemoryStore) HasFeed(name string) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	_, ok := ms.feeds[name]
+	return ok
+}
+
+func (ms *MemoryStore) DelFeed(name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.feeds, name)
+	return nil
+}
+
+func (ms *MemoryStore) GetFeed(name string) (*Feed, error) {
+	ms.mu.RLock()
+	data, ok := ms.feeds[name]
+	ms.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrFeedNotFound
+	}
+	return LoadFeed(data)
+}
+
+func (ms *MemoryStore) SetFeed(name string, feed *Feed) error {
+	data, err := feed.Bytes()
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	ms.feeds[name] = data
+	ms.mu.Unlock()
+
+	return nil
+}
+
+func (ms *MemoryStore) LenFeeds() int64 {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return int64(len(ms.feeds))
+}
+
+func (ms *MemoryStore) SearchFeeds(prefix string) []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return searchKeys(ms.feeds, prefix)
+}
+
+func (ms *MemoryStore) GetAllFeeds() ([]*Feed, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var feeds []*Feed
+	for _, data := range ms.feeds {
+		feed, err := LoadFeed(data)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, nil
+}
+
+func (ms *MemoryStore) HasUser(username string) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	_, ok := ms.users[username]
+	return ok
+}
+
+func (ms *MemoryStore) DelUser(username string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.users, username)
+	return nil
+}
+
+func (ms *MemoryStore) GetUser(username string) (*User, error) {
+	ms.mu.RLock()
+	data, ok := ms.users[username]
+	ms.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return LoadUser(data)
+}
+
+func (ms *MemoryStore) SetUser(username string, user *User) error {
+	data, err := user.Bytes()
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	ms.users[username] = data
+	ms.mu.Unlock()
+
+	return nil
+}
+
+func (ms *MemoryStore) LenUsers() int64 {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return int64(len(ms.users))
+}
+
+func (ms *MemoryStore) SearchUsers(prefix string) []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return searchKeys(ms.users, prefix)
+}
+
+func (ms *MemoryStore) GetAllUsers() ([]*User, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var users []*User
+	for _, data := range ms.users {
+		user, err := LoadUser(data)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+func (ms *MemoryStore) GetSession(sid string) (*session.Session, error) {
+	ms.mu.RLock()
+	data, ok := ms.sessions[sid]
+	ms.mu.RUnlock()
+
+	if !ok {
+		return nil, session.ErrSessionNotFound
+	}
+	sess := session.NewSession(ms)
+	if err := session.LoadSession(data, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (ms *MemoryStore) SetSession(sid string, sess *session.Session) error {
+	data, err := sess.Bytes()
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	ms.sessions[sid] = data
+	ms.mu.Unlock()
+
+	return nil
+}
+
+func (ms *MemoryStore) HasSession(sid string) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	_, ok := ms.sessions[sid]
+	return ok
+}
+
+func (ms *MemoryStore) DelSession(sid string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.sessions, sid)
+	return nil
+}
+
+func (ms *MemoryStore) SyncSession(sess *session.Session) error {
+	// Only persist sessions with a logged in user associated with an account
+	// so that we behave the same as the on-disk stores.
+	if sess.Has("username") {
+		return ms.SetSession(sess.ID, sess)
+	}
+	return nil
+}
+
+func (ms *MemoryStore) LenSessions() int64 {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return int64(len(ms.sessions))
+}
+
+func (ms *MemoryStore) GetAllSessions() ([]*session.Session, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var sessions []*session.Session
+	for _, data := range ms.sessions {
+		sess := session.NewSession(ms)
+		if err := session.LoadSession(data, sess); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+
+	return sessions, nil
+}
+
+func (ms *MemoryStore) GetUserTokens(user *User) ([]*Token, error) {
+	tokens := []*Token{}
+	for _, signature := range user.Tokens {
+		tkn, err := ms.GetToken(signature)
+		if err != nil {
+			return tokens, err
+		}
+
+		tokens = append(tokens, tkn)
+	}
+
+	return tokens, nil
+}
+
+func (ms *MemoryStore) GetToken(signature string) (*Token, error) {
+	ms.mu.RLock()
+	data, ok := ms.tokens[signature]
+	ms.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return LoadToken(data)
+}
+
+func (ms *MemoryStore) SetToken(signature string, tkn *Token) error {
+	data, err := tkn.Bytes()
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	ms.tokens[signature] = data
+	ms.mu.Unlock()
+
+	return nil
+}
+
+func (ms *MemoryStore) DelToken(signature string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.tokens, signature)
+	return nil
+}
+
+func (ms *MemoryStore) LenTokens() int64 {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return int64(len(ms.tokens))
+}
@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Migration is a single, ordered and idempotent change to the data in a
+// Store (and the data directory). Migrations are applied exactly once in
+// order of their Version, which is recorded in the Store once applied.
+//
+// A migration must not write anything when dryRun is true, but should still
+// report every change it would make.
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(m *Migrator, dryRun bool) ([]string, error)
+}
+
+// Migrations is the ordered list of all schema migrations.
+// New migrations must be appended with the next version number. Version 1
+// normalized user and feed records with null maps, which LoadUser and
+// LoadFeed do as they decode records instead.
+var Migrations = []Migration{
+	{2, "create special and bot feeds", migrateSpecialFeeds},
+	{3, "fix missing followers", migrateFixFollowers},
+	{4, "archive missing twts", migrateArchiveMissingTwts},
+}
+
+// LatestSchemaVersion returns the schema version after all migrations applied
+func LatestSchemaVersion() int {
+	if len(Migrations) == 0 {
+		return 0
+	}
+	return Migrations[len(Migrations)-1].Version
+}
+
+// MigrationResult ...
+type MigrationResult struct {
+	Version     int
+	Description string
+	Changes     []string
+}
+
+// MigrationReport ...
+type MigrationReport struct {
+	DryRun  bool
+	From    int
+	To      int
+	Results []MigrationResult
+}
+
+// Changes returns the total number of changes made (or that would be made)
+func (r *MigrationReport) Changes() (n int) {
+	for _, result := range r.Results {
+		n += len(result.Changes)
+	}
+	return
+}
+
+// Migrator applies Migrations to a Store
+type Migrator struct {
+	conf    *Config
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+// NewMigrator ...
+func NewMigrator(conf *Config, cache *Cache, archive Archiver, db Store) *Migrator {
+	return &Migrator{conf: conf, cache: cache, archive: archive, db: db}
+}
+
+// Run applies all pending migrations in order and returns a report of what
+// was changed. If dryRun is true nothing is written and the report contains
+// what would have been changed.
+func (m *Migrator) Run(dryRun bool) (*MigrationReport, error) {
+	current, err := m.db.GetSchemaVersion()
+	if err != nil {
+		log.WithError(err).Error("error reading schema version")
+		return nil, err
+	}
+
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return nil, fmt.Errorf(
+			"error: store schema version %d is newer than supported version %d",
+			current, latest,
+		)
+	}
+
+	report := &MigrationReport{DryRun: dryRun, From: current, To: current}
+
+	for _, migration := range Migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		log.Infof("applying migration %d: %s (dry-run: %t)", migration.Version, migration.Description, dryRun)
+
+		changes, err := migration.Migrate(m, dryRun)
+		if err != nil {
+			log.WithError(err).Errorf("error applying migration %d", migration.Version)
+			return report, err
+		}
+
+		for _, change := range changes {
+			log.Infof("migration %d: %s", migration.Version, change)
+		}
+
+		report.Results = append(report.Results, MigrationResult{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Changes:     changes,
+		})
+		report.To = migration.Version
+
+		if dryRun {
+			continue
+		}
+
+		if err := m.db.SetSchemaVersion(migration.Version); err != nil {
+			log.WithError(err).Errorf("error recording schema version %d", migration.Version)
+			return report, err
+		}
+	}
+
+	if !dryRun {
+		if err := m.db.Sync(); err != nil {
+			log.WithError(err).Error("error syncing store")
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// migrateSpecialFeeds creates the twtxt bot feeds and the special feeds
+// owned by the pod's admin user (if the admin user has registered yet, see
+// AttachSpecialFeeds)
+func migrateSpecialFeeds(m *Migrator, dryRun bool) ([]string, error) {
+	var changes []string
+
+	for _, feed := range twtxtBots {
+		if m.db.HasFeed(feed) {
+			continue
+		}
+
+		changes = append(changes, fmt.Sprintf("created bot feed %s", feed))
+		if dryRun {
+			continue
+		}
+
+		if err := CreateFeed(m.conf, m.db, nil, feed, true); err != nil {
+			return changes, err
+		}
+	}
+
+	adminUser, err := m.db.GetUser(m.conf.AdminUser)
+	if err != nil {
+		log.Warnf("admin user %s not registered yet, special feeds will be created on registration", m.conf.AdminUser)
+		return changes, nil
+	}
+
+	for _, feed := range specialUsernames {
+		if adminUser.OwnsFeed(feed) && m.db.HasFeed(feed) {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("created special feed %s for %s", feed, adminUser.Username))
+	}
+
+	if dryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	if err := AttachSpecialFeeds(m.conf, m.db, adminUser); err != nil {
+		return changes, err
+	}
+
+	return changes, nil
+}
+
+// migrateFixFollowers adds local followers missing from the .Followers of the
+// users and feeds they follow.
+func migrateFixFollowers(m *Migrator, dryRun bool) ([]string, error) {
+	var changes []string
+
+	feeds, err := m.db.GetAllFeeds()
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := m.db.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, followee := range feeds {
+		var changed bool
+		for _, follower := range users {
+			if follower.Follows(followee.URL) && !followee.FollowedBy(follower.URL) {
+				changes = append(changes, fmt.Sprintf("added follower %s to feed %s", follower.Username, followee.Name))
+				followee.Followers[follower.Username] = follower.URL
+				changed = true
+			}
+		}
+		if changed && !dryRun {
+			if err := m.db.SetFeed(followee.Name, followee); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	for _, followee := range users {
+		var changed bool
+		for _, follower := range users {
+			if follower.Follows(followee.URL) && !followee.FollowedBy(follower.URL) {
+				changes = append(changes, fmt.Sprintf("added follower %s to user %s", follower.Username, followee.Username))
+				followee.Followers[follower.Username] = follower.URL
+				changed = true
+			}
+		}
+		if changed && !dryRun {
+			if err := m.db.SetUser(followee.Username, followee); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// migrateArchiveMissingTwts archives local twts that are neither in the
+// cache nor in the archive.
+func migrateArchiveMissingTwts(m *Migrator, dryRun bool) ([]string, error) {
+	var changes []string
+
+	p := filepath.Join(m.conf.Data, feedsDir)
+	fileInfos, err := ioutil.ReadDir(p)
+	if err != nil {
+		log.WithError(err).Warn("error reading feeds")
+		return nil, nil
+	}
+
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		twts, err := GetAllTwts(m.conf, name)
+		if err != nil {
+			log.WithError(err).Warnf("error loading twts for %s", name)
+			continue
+		}
+
+		for _, twt := range twts {
+			// Twts whose hashes collide with one already cached or
+			// archived are still missing
+			candidates, err := m.cache.LookupAll(m.archive, twt.Hash())
+			if err != nil {
+				return changes, err
+			}
+			if hasTwt(candidates, twt) {
+				continue
+			}
+
+			changes = append(changes, fmt.Sprintf("archived missing twt %s from %s", twt.Hash(), name))
+			if dryRun {
+				continue
+			}
+
+			if err := m.archive.Archive(twt); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	return changes, nil
+}
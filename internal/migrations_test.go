@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrator(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := ioutil.TempDir("", "twtxt-migrations")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(data)
+	assert.NoError(os.MkdirAll(filepath.Join(data, feedsDir), 0755))
+
+	conf := NewConfig()
+	conf.Data = data
+	conf.BaseURL = "http://0.0.0.0:8000"
+
+	archive, err := NewNullArchiver()
+	assert.NoError(err)
+	cache, err := LoadCache(data, archive, NewFeedWriter())
+	assert.NoError(err)
+	db := newMemoryStore()
+
+	// alice follows bob but is not listed as one of bob's followers
+	alice := NewUser()
+	alice.Username = "alice"
+	alice.URL = URLForUser(conf, "alice")
+	alice.Following["bob"] = URLForUser(conf, "bob")
+	assert.NoError(db.SetUser("alice", alice))
+
+	bob := NewUser()
+	bob.Username = "bob"
+	bob.URL = URLForUser(conf, "bob")
+	assert.NoError(db.SetUser("bob", bob))
+
+	m := NewMigrator(conf, cache, archive, db)
+
+	report, err := m.Run(true)
+	assert.NoError(err)
+	assert.True(report.DryRun)
+	assert.Equal(LatestSchemaVersion(), report.To)
+	assert.NotZero(report.Changes())
+
+	// A dry-run must not change anything
+	version, err := db.GetSchemaVersion()
+	assert.NoError(err)
+	assert.Equal(0, version)
+	bob, err = db.GetUser("bob")
+	assert.NoError(err)
+	assert.Empty(bob.Followers)
+
+	report, err = m.Run(false)
+	assert.NoError(err)
+	assert.Equal(0, report.From)
+	assert.Equal(LatestSchemaVersion(), report.To)
+
+	bob, err = db.GetUser("bob")
+	assert.NoError(err)
+	assert.Equal(alice.URL, bob.Followers["alice"])
+
+	// Migrations are only ever applied once
+	report, err = m.Run(false)
+	assert.NoError(err)
+	assert.Empty(report.Results)
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -132,12 +133,29 @@ func CreateFeed(conf *Config, db Store, user *User, name string, force bool) err
 	feed.Followers = followers
 	feed.CreatedAt = time.Now()
 
-	if err := db.SetFeed(name, feed); err != nil {
+	batch := NewBatch()
+	if err := batch.SetFeed(name, feed); err != nil {
 		return err
 	}
 
 	if user != nil {
 		user.Follow(name, feed.URL)
+		if err := batch.SetUser(user.Username, user); err != nil {
+			return err
+		}
+	}
+
+	return db.Commit(batch)
+}
+
+// AttachSpecialFeeds creates the pod's special feeds (if missing) and makes
+// the given user (the pod's admin user) their owner.
+func AttachSpecialFeeds(conf *Config, db Store, user *User) error {
+	for _, feed := range specialUsernames {
+		if err := CreateFeed(conf, db, user, feed, true); err != nil {
+			log.WithError(err).Warnf("error creating special feed %s", feed)
+			return err
+		}
 	}
 
 	return nil
@@ -148,31 +166,118 @@ func DetachFeedFromOwner(db Store, user *User, feed *Feed) (err error) {
 	delete(user.sources, feed.URL)
 
 	user.Feeds = RemoveString(user.Feeds, feed.Name)
-	if err = db.SetUser(user.Username, user); err != nil {
+	delete(feed.Followers, user.Username)
+
+	batch := NewBatch()
+	if err = batch.SetUser(user.Username, user); err != nil {
 		return
 	}
-
-	delete(feed.Followers, user.Username)
-	if err = db.SetFeed(feed.Name, feed); err != nil {
+	if err = batch.SetFeed(feed.Name, feed); err != nil {
 		return
 	}
 
-	return nil
+	return db.Commit(batch)
 }
 
-func RemoveFeedOwnership(db Store, user *User, feed *Feed) (err error) {
-	user.Feeds = RemoveString(user.Feeds, feed.Name)
-	if err = db.SetUser(user.Username, user); err != nil {
+// TransferFeedOwnership transfers ownership of the feed from one user to another
+func TransferFeedOwnership(db Store, from, to *User, feed *Feed) (err error) {
+	from.Feeds = RemoveString(from.Feeds, feed.Name)
+	if !to.OwnsFeed(feed.Name) {
+		to.Feeds = append(to.Feeds, feed.Name)
+	}
+
+	batch := NewBatch()
+	if err = batch.SetUser(from.Username, from); err != nil {
+		return
+	}
+	if err = batch.SetUser(to.Username, to); err != nil {
 		return
 	}
 
-	return nil
+	return db.Commit(batch)
 }
 
-func AddFeedOwnership(db Store, user *User, feed *Feed) (err error) {
-	user.Feeds = append(user.Feeds, feed.Name)
-	if err = db.SetUser(user.Username, user); err != nil {
-		return
+// renameURL replaces the url from with to in a map of nick to url (such as
+// Following or Followers) and returns true if it was found
+func renameURL(m map[string]string, from, to string) bool {
+	var found bool
+	for nick, url := range m {
+		if NormalizeURL(url) == from {
+			m[nick] = to
+			found = true
+		}
+	}
+	return found
+}
+
+// MoveFeed rewrites every local reference to the feed at url from to the url
+// to after the feed has permanently moved there. This updates the Following
+// and Followers of local users and the Followers of local feeds in a single
+// batch. If conf.FeedMoveNotices is set the twtxt bot posts a notice
+// mentioning the users whose follows were updated.
+func MoveFeed(conf *Config, feedWriter *FeedWriter, db Store, from, to string) error {
+	from = NormalizeURL(from)
+	if from == "" || to == "" {
+		return fmt.Errorf("error: invalid feed move from %q to %q", from, to)
+	}
+
+	users, err := db.GetAllUsers()
+	if err != nil {
+		return err
+	}
+
+	feeds, err := db.GetAllFeeds()
+	if err != nil {
+		return err
+	}
+
+	batch := NewBatch()
+
+	var mentions []string
+	for _, user := range users {
+		following := renameURL(user.Following, from, to)
+		followers := renameURL(user.Followers, from, to)
+		if !following && !followers {
+			continue
+		}
+		if following {
+			mentions = append(mentions, fmt.Sprintf("@<%s %s>", user.Username, user.URL))
+		}
+		if err := batch.SetUser(user.Username, user); err != nil {
+			return err
+		}
+	}
+
+	for _, feed := range feeds {
+		if !renameURL(feed.Followers, from, to) {
+			continue
+		}
+		if err := batch.SetFeed(feed.Name, feed); err != nil {
+			return err
+		}
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	if err := db.Commit(batch); err != nil {
+		return err
+	}
+
+	log.Infof("moved feed %s to %s (%d users updated)", from, to, len(mentions))
+
+	if conf.FeedMoveNotices && len(mentions) > 0 {
+		if _, err := AppendSpecial(
+			conf, feedWriter, db,
+			twtxtBot,
+			fmt.Sprintf(
+				"MOVED: %s has permanently moved to %s, updated follows of %s",
+				from, to, strings.Join(mentions, " "),
+			),
+		); err != nil {
+			log.WithError(err).Warnf("error appending special MOVED post")
+		}
 	}
 
 	return nil
@@ -198,6 +303,8 @@ func LoadFeed(data []byte) (feed *Feed, err error) {
 		return nil, err
 	}
 
+	// Older records (and any written with null maps) are normalized here,
+	// as they are decoded, so that no record needs migrating
 	if feed.Followers == nil {
 		feed.Followers = make(map[string]string)
 	}
@@ -232,12 +339,17 @@ func LoadUser(data []byte) (user *User, err error) {
 		return nil, err
 	}
 
+	// Older records (and any written with null maps) are normalized here,
+	// as they are decoded, so that no record needs migrating
 	if user.Followers == nil {
 		user.Followers = make(map[string]string)
 	}
 	if user.Following == nil {
 		user.Following = make(map[string]string)
 	}
+	if user.Muted == nil {
+		user.Muted = make(map[string]string)
+	}
 
 	user.muted = make(map[string]string)
 	for n, u := range user.Muted {
@@ -306,6 +418,20 @@ func (f *Feed) Profile(baseURL string, viewer *User) types.Profile {
 	}
 }
 
+// Metadata returns the headers describing the feed written at the top of
+// its twtxt.txt
+func (f *Feed) Metadata(conf *Config) *types.Metadata {
+	return &types.Metadata{
+		Nick:        f.Name,
+		URL:         URLForUser(conf, f.Name),
+		Avatar:      URLForAvatar(conf, f.Name),
+		Description: f.Description,
+		Links: []types.FeedLink{
+			{Title: "Blog", URL: URLForBlogs(conf.BaseURL, f.Name)},
+		},
+	}
+}
+
 func (f *Feed) Bytes() ([]byte, error) {
 	data, err := json.Marshal(f)
 	if err != nil {
@@ -430,6 +556,33 @@ func (u *User) Sources() types.Feeds {
 	return feeds
 }
 
+// Metadata returns the headers describing the user's feed written at the top
+// of their twtxt.txt, who they follow is only included if it is publicly
+// visible
+func (u *User) Metadata(conf *Config) *types.Metadata {
+	meta := &types.Metadata{
+		Nick:        u.Username,
+		URL:         URLForUser(conf, u.Username),
+		Avatar:      URLForAvatar(conf, u.Username),
+		Description: u.Tagline,
+		Links: []types.FeedLink{
+			{Title: "Blog", URL: URLForBlogs(conf.BaseURL, u.Username)},
+		},
+	}
+
+	if u.IsFollowingPubliclyVisible {
+		for nick, url := range u.Following {
+			meta.Follow = append(meta.Follow, types.Feed{Nick: nick, URL: url})
+		}
+		// Sorted so the headers (and the feed's Etag) are stable
+		sort.Slice(meta.Follow, func(i, j int) bool {
+			return meta.Follow[i].Nick < meta.Follow[j].Nick
+		})
+	}
+
+	return meta
+}
+
 func (u *User) Profile(baseURL string, viewer *User) types.Profile {
 	var (
 		follows    bool
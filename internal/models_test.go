@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+func TestMoveFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := NewConfig()
+	conf.BaseURL = "http://0.0.0.0:8000"
+
+	db := newMemoryStore()
+
+	alice := NewUser()
+	alice.Username = "alice"
+	alice.URL = URLForUser(conf, "alice")
+	alice.Following["bob"] = "https://old.example.com/twtxt.txt"
+	alice.Following["carol"] = "https://carol.example.com/twtxt.txt"
+	assert.NoError(db.SetUser("alice", alice))
+
+	news := NewFeed()
+	news.Name = "news"
+	news.URL = URLForUser(conf, "news")
+	news.Followers["bob"] = "https://old.example.com/twtxt.txt"
+	assert.NoError(db.SetFeed("news", news))
+
+	assert.NoError(MoveFeed(conf, NewFeedWriter(), db, "https://old.example.com/twtxt.txt", "https://new.example.com/twtxt.txt"))
+
+	alice, err := db.GetUser("alice")
+	assert.NoError(err)
+	assert.Equal("https://new.example.com/twtxt.txt", alice.Following["bob"])
+	assert.Equal("https://carol.example.com/twtxt.txt", alice.Following["carol"])
+	assert.True(alice.Follows("https://new.example.com/twtxt.txt"))
+	assert.False(alice.Follows("https://old.example.com/twtxt.txt"))
+
+	news, err = db.GetFeed("news")
+	assert.NoError(err)
+	assert.Equal("https://new.example.com/twtxt.txt", news.Followers["bob"])
+}
+
+func TestUserMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := NewConfig()
+	conf.BaseURL = "http://0.0.0.0:8000"
+
+	alice := NewUser()
+	alice.Username = "alice"
+	alice.Tagline = "Hello World"
+	alice.IsFollowingPubliclyVisible = true
+	alice.Following["carol"] = "https://carol.example.com/twtxt.txt"
+	alice.Following["bob"] = "https://bob.example.com/twtxt.txt"
+
+	meta := alice.Metadata(conf)
+	assert.Equal("alice", meta.Nick)
+	assert.Equal(URLForUser(conf, "alice"), meta.URL)
+	assert.Equal(URLForAvatar(conf, "alice"), meta.Avatar)
+	assert.Equal("Hello World", meta.Description)
+	assert.Equal([]types.Feed{
+		{Nick: "bob", URL: "https://bob.example.com/twtxt.txt"},
+		{Nick: "carol", URL: "https://carol.example.com/twtxt.txt"},
+	}, meta.Follow)
+
+	alice.IsFollowingPubliclyVisible = false
+	assert.Empty(alice.Metadata(conf).Follow)
+}
+
+func TestLoadNullMaps(t *testing.T) {
+	assert := assert.New(t)
+
+	user, err := LoadUser([]byte(`{"Username":"alice","followers":null,"Following":null,"muted":null}`))
+	assert.NoError(err)
+	assert.NotNil(user.Followers)
+	assert.NotNil(user.Following)
+	assert.NotNil(user.Muted)
+	user.Followers["bob"] = "https://bob.example.com/twtxt.txt"
+
+	feed, err := LoadFeed([]byte(`{"Name":"news","followers":null}`))
+	assert.NoError(err)
+	assert.NotNil(feed.Followers)
+	feed.Followers["bob"] = "https://bob.example.com/twtxt.txt"
+}
@@ -86,11 +86,30 @@ const (
 	// DefaultMaxFetchLimit is the maximum fetch fetch limit in bytes
 	DefaultMaxFetchLimit = 1 << 21 // ~2MB (or more than enough for a year)
 
+	// DefaultMinFetchInterval is the shortest interval a feed is polled on
+	DefaultMinFetchInterval = 5 * time.Minute
+
+	// DefaultMaxFetchInterval is the longest interval a feed is polled on
+	DefaultMaxFetchInterval = 6 * time.Hour
+
+	// DefaultFeedRotateAge is the age of twts rotated out of local feeds
+	// into archive files, 0 disables rotating twts by age
+	DefaultFeedRotateAge = 0
+
+	// DefaultFeedRotateSize is the size in bytes local feeds are kept under
+	// by rotating their oldest twts into archive files, so that they can
+	// always be fetched in full within DefaultMaxFetchLimit
+	DefaultFeedRotateSize = DefaultMaxFetchLimit / 2
+
 	// DefaultAPISessionTime is the server's default session time for API tokens
 	DefaultAPISessionTime = 240 * time.Hour // 10 days
 
 	// DefaultAPISigningKey is the default API JWT signing key for tokens
 	DefaultAPISigningKey = "PLEASE_CHANGE_ME!!!"
+
+	// DefaultFeedMoveNotices is the default for posting a notice when a
+	// followed feed has permanently moved
+	DefaultFeedMoveNotices = false
 )
 
 var (
@@ -145,6 +164,11 @@ func NewConfig() *Config {
 		SMTPPort:          DefaultSMTPPort,
 		SMTPUser:          DefaultSMTPUser,
 		SMTPPass:          DefaultSMTPPass,
+		MinFetchInterval:  DefaultMinFetchInterval,
+		MaxFetchInterval:  DefaultMaxFetchInterval,
+		FeedRotateAge:     DefaultFeedRotateAge,
+		FeedRotateSize:    DefaultFeedRotateSize,
+		FeedMoveNotices:   DefaultFeedMoveNotices,
 	}
 }
 
@@ -182,7 +206,9 @@ func WithBaseURL(baseURL string) Option {
 		if err != nil {
 			return err
 		}
-		cfg.BaseURL = baseURL
+		// Normalized so the urls of local feeds (see URLForUser) are the
+		// same as those they are followed by
+		cfg.BaseURL = NormalizeURL(baseURL)
 		cfg.baseURL = u
 		return nil
 	}
@@ -300,6 +326,15 @@ func WithOpenProfiles(openProfiles bool) Option {
 	}
 }
 
+// WithFeedMoveNotices sets whether or not to post a notice when a followed
+// feed has permanently moved
+func WithFeedMoveNotices(feedMoveNotices bool) Option {
+	return func(cfg *Config) error {
+		cfg.FeedMoveNotices = feedMoveNotices
+		return nil
+	}
+}
+
 // WithMaxUploadSize sets the maximum upload size permitted by the server
 func WithMaxUploadSize(maxUploadSize int64) Option {
 	return func(cfg *Config) error {
@@ -388,6 +423,38 @@ func WithMaxFetchLimit(limit int64) Option {
 	}
 }
 
+// WithMinFetchInterval sets the shortest interval a feed is polled on
+func WithMinFetchInterval(interval time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.MinFetchInterval = interval
+		return nil
+	}
+}
+
+// WithMaxFetchInterval sets the longest interval a feed is polled on
+func WithMaxFetchInterval(interval time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.MaxFetchInterval = interval
+		return nil
+	}
+}
+
+// WithFeedRotateAge sets the age of twts rotated out of local feeds
+func WithFeedRotateAge(age time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.FeedRotateAge = age
+		return nil
+	}
+}
+
+// WithFeedRotateSize sets the size in bytes local feeds are kept under
+func WithFeedRotateSize(size int64) Option {
+	return func(cfg *Config) error {
+		cfg.FeedRotateSize = size
+		return nil
+	}
+}
+
 // WithAPISessionTime sets the API session time for tokens
 func WithAPISessionTime(duration time.Duration) Option {
 	return func(cfg *Config) error {
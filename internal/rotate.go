@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// archivedFeedsDir holds the archive files twts are rotated into out of
+	// local feeds, see RotateFeed()
+	archivedFeedsDir = "archived-feeds"
+)
+
+// feedArchiveName returns the name of a new archive file of a feed rotated at
+// t that does not exist in dir yet
+func feedArchiveName(dir string, t time.Time) string {
+	date := t.Format("2006-01-02")
+	name := fmt.Sprintf("twtxt-%s.txt", date)
+	for i := 1; FileExists(filepath.Join(dir, name)); i++ {
+		name = fmt.Sprintf("twtxt-%s.%d.txt", date, i)
+	}
+	return name
+}
+
+// RotateFeed moves the twts of the local feed name that are older than
+// conf.FeedRotateAge or beyond the newest conf.FeedRotateSize bytes of the
+// feed into a new archive file (see URLForFeedArchive) and returns them. The
+// feed's `# prev` header (see types.Metadata) is pointed at the new archive
+// file which in turn points at the previous one (if any). The newest twt of
+// a feed is never rotated.
+func RotateFeed(conf *Config, feedWriter *FeedWriter, name string) (types.Twts, error) {
+	fn := filepath.Join(conf.Data, feedsDir, name)
+
+	twter := types.Twter{
+		Nick:   name,
+		URL:    URLForUser(conf, name),
+		Avatar: URLForAvatar(conf, name),
+	}
+
+	var rotated types.Twts
+
+	// The feed stays locked whilst the archive file is written so that no
+	// twt is posted to or edited in it in between
+	err := feedWriter.Rewrite(fn, func(data []byte) ([]byte, error) {
+		var (
+			lines = strings.SplitAfter(string(data), "\n")
+			twts  = make([]types.Twt, len(lines))
+			prev  *types.FeedArchive
+		)
+
+		for i, line := range lines {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "#") {
+				var meta types.Metadata
+				if meta.ParseLine(line) && meta.Prev != nil {
+					prev = meta.Prev
+					lines[i] = ""
+				}
+				continue
+			}
+			if twt, err := types.ParseLine(line, twter); err == nil && !twt.IsZero() {
+				twts[i] = twt
+			}
+		}
+
+		// Twts are appended to a feed so keep the newest (last) twts that are
+		// neither too old nor too many bytes and rotate everything before them
+		var (
+			cutoff = time.Now().Add(-conf.FeedRotateAge)
+			size   int64
+			keep   = len(lines)
+		)
+		for i := len(lines) - 1; i >= 0; i-- {
+			if twts[i] == nil {
+				continue
+			}
+			size += int64(len(lines[i]))
+			if keep < len(lines) {
+				if conf.FeedRotateAge > 0 && twts[i].Created().Before(cutoff) {
+					break
+				}
+				if conf.FeedRotateSize > 0 && size > conf.FeedRotateSize {
+					break
+				}
+			}
+			keep = i
+		}
+
+		var newest types.Twt
+		for _, twt := range twts[:keep] {
+			if twt == nil {
+				continue
+			}
+			rotated = append(rotated, twt)
+			if newest == nil || twt.Created().After(newest.Created()) {
+				newest = twt
+			}
+		}
+		if len(rotated) == 0 {
+			return nil, ErrFeedUnchanged
+		}
+
+		dir := filepath.Join(conf.Data, archivedFeedsDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.WithError(err).Error("error creating archived feeds directory")
+			return nil, err
+		}
+		archiveName := feedArchiveName(dir, time.Now())
+
+		// Archive files are served next to each other so only their names
+		// are needed to point at the previous one
+		var archived strings.Builder
+		if prev != nil {
+			archived.WriteString((&types.Metadata{
+				Prev: &types.FeedArchive{Hash: prev.Hash, URL: path.Base(prev.URL)},
+			}).String())
+		}
+		archived.WriteString(strings.Join(lines[:keep], ""))
+
+		if err := feedWriter.Replace(filepath.Join(dir, archiveName), []byte(archived.String())); err != nil {
+			log.WithError(err).Errorf("error writing archive file %s of feed %s", archiveName, name)
+			return nil, err
+		}
+
+		var feed strings.Builder
+		feed.WriteString((&types.Metadata{
+			Prev: &types.FeedArchive{Hash: newest.Hash(), URL: "archive/" + archiveName},
+		}).String())
+		feed.WriteString(strings.Join(lines[keep:], ""))
+
+		return []byte(feed.String()), nil
+	})
+	if err != nil {
+		log.WithError(err).Errorf("error rotating feed %s", name)
+		return nil, err
+	}
+
+	return rotated, nil
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestRotateFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	retwt.DefaultTwtManager()
+
+	data, err := ioutil.TempDir("", "twtxt-rotate-*")
+	assert.NoError(err)
+	defer os.RemoveAll(data)
+	assert.NoError(os.MkdirAll(filepath.Join(data, feedsDir), 0755))
+
+	w := NewFeedWriter()
+
+	conf := NewConfig()
+	conf.Data = data
+	conf.BaseURL = "http://0.0.0.0:8000"
+	conf.FeedRotateAge = 24 * time.Hour
+	conf.FeedRotateSize = 0
+
+	now := time.Now().UTC()
+	line := func(age time.Duration, text string) string {
+		return now.Add(-age).Format(time.RFC3339) + "\t" + text + "\n"
+	}
+
+	fn := filepath.Join(data, feedsDir, "alice")
+	feed := line(72*time.Hour, "one") + line(48*time.Hour, "two") + line(time.Hour, "three")
+	assert.NoError(ioutil.WriteFile(fn, []byte(feed), 0644))
+
+	read := func(fn string) (types.Twts, *types.Metadata) {
+		f, err := os.Open(fn)
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+		defer f.Close()
+		twts, _, meta, err := types.ParseFile(f, types.Twter{Nick: "alice", URL: URLForUser(conf, "alice")}, 0, 0)
+		assert.NoError(err)
+		return twts, meta
+	}
+	texts := func(twts types.Twts) (res []string) {
+		for _, twt := range twts {
+			res = append(res, twt.Text())
+		}
+		return
+	}
+
+	rotated, err := RotateFeed(conf, w, "alice")
+	assert.NoError(err)
+	assert.Equal([]string{"one", "two"}, texts(rotated))
+
+	twts, meta := read(fn)
+	assert.Equal([]string{"three"}, texts(twts))
+	assert.Equal(rotated[1].Hash(), meta.Prev.Hash)
+	assert.True(strings.HasPrefix(meta.Prev.URL, "archive/twtxt-"))
+
+	first := filepath.Join(data, archivedFeedsDir, "alice", strings.TrimPrefix(meta.Prev.URL, "archive/"))
+	twts, firstMeta := read(first)
+	assert.Equal([]string{"two", "one"}, texts(twts))
+	assert.Nil(firstMeta.Prev)
+
+	// Nothing to rotate and the newest twt is always kept
+	rotated, err = RotateFeed(conf, w, "alice")
+	assert.NoError(err)
+	assert.Empty(rotated)
+
+	conf.FeedRotateAge = 0
+	conf.FeedRotateSize = 1
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(err)
+	_, err = f.WriteString(line(0, "four"))
+	assert.NoError(err)
+	f.Close()
+
+	rotated, err = RotateFeed(conf, w, "alice")
+	assert.NoError(err)
+	assert.Equal([]string{"three"}, texts(rotated))
+
+	twts, second := read(fn)
+	assert.Equal([]string{"four"}, texts(twts))
+	assert.NotEqual(meta.Prev.URL, second.Prev.URL)
+
+	// The new archive file points at the previous one
+	twts, secondMeta := read(filepath.Join(data, archivedFeedsDir, "alice", strings.TrimPrefix(second.Prev.URL, "archive/")))
+	assert.Equal([]string{"three"}, texts(twts))
+	assert.Equal(&types.FeedArchive{Hash: meta.Prev.Hash, URL: filepath.Base(first)}, secondMeta.Prev)
+}
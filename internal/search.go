@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+var (
+	ErrInvalidSearchQuery = errors.New("error: invalid search query")
+)
+
+// searchMarkupRe matches the @<nick url> mentions and #<tag url> tags in a
+// twt's text so that only the nick or tag is searched
+var searchMarkupRe = regexp.MustCompile(`([@#])<([^ >]+)(?: [^>]*)?>`)
+
+// searchWords returns the words of text lower cased for searching, words
+// are runs of letters and numbers
+func searchWords(text string) []string {
+	text = strings.ToLower(searchMarkupRe.ReplaceAllString(text, "$1$2"))
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// twtSearchKeys returns the keys a twt is indexed by for searching, its words
+// and its author, mentions and tags as from:nick, mentions:nick and tag:tag
+func twtSearchKeys(twt types.Twt) []string {
+	seen := make(map[string]bool)
+	var keys []string
+
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	for _, word := range searchWords(twt.Text()) {
+		add(word)
+	}
+	if nick := twt.Twter().Nick; nick != "" {
+		add("from:" + strings.ToLower(nick))
+	}
+	for _, mention := range twt.Mentions() {
+		if nick := mention.Twter().Nick; nick != "" {
+			add("mentions:" + strings.ToLower(nick))
+		}
+	}
+	for _, tag := range twt.Tags() {
+		add("tag:" + strings.ToLower(tag.Tag()))
+	}
+
+	return keys
+}
+
+// SearchQuery is a parsed full-text search query, see ParseSearchQuery()
+type SearchQuery struct {
+	Words    []string
+	Phrases  []string
+	From     []string
+	Mentions []string
+	Tags     []string
+	Before   time.Time
+	After    time.Time
+}
+
+// parseSearchDate parses the value of a before: or after: search operator
+// which is either a date (2006-01-02) or a RFC3339 timestamp
+func parseSearchDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ParseSearchQuery parses a full-text search query. A query is made up of
+// words and "quoted phrases" that must all appear in a twt along with any of
+// the operators:
+//
+//	from:nick      twts posted by nick
+//	mentions:nick  twts mentioning nick
+//	tag:tag        twts tagged with tag (also #tag)
+//	before:date    twts posted before date (2006-01-02 or RFC3339)
+//	after:date     twts posted after date
+//
+// A query must contain at least one word, phrase, from:, mentions: or tag:
+func ParseSearchQuery(q string) (*SearchQuery, error) {
+	query := &SearchQuery{}
+
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		var token string
+
+		if q[0] == '"' {
+			end := strings.IndexByte(q[1:], '"')
+			if end == -1 {
+				token, q = q[1:], ""
+			} else {
+				token, q = q[1:end+1], q[end+2:]
+			}
+			if phrase := strings.Join(searchWords(token), " "); phrase != "" {
+				query.Phrases = append(query.Phrases, phrase)
+			}
+			continue
+		}
+
+		if end := strings.IndexFunc(q, unicode.IsSpace); end == -1 {
+			token, q = q, ""
+		} else {
+			token, q = q[:end], q[end:]
+		}
+
+		op, value := "", token
+		if i := strings.IndexByte(token, ':'); i > 0 {
+			op, value = strings.ToLower(token[:i]), token[i+1:]
+		}
+
+		switch op {
+		case "from", "mentions":
+			value = strings.ToLower(strings.TrimPrefix(value, "@"))
+			if value == "" {
+				return nil, ErrInvalidSearchQuery
+			}
+			if op == "from" {
+				query.From = append(query.From, value)
+			} else {
+				query.Mentions = append(query.Mentions, value)
+			}
+		case "tag":
+			value = strings.ToLower(strings.TrimPrefix(value, "#"))
+			if value == "" {
+				return nil, ErrInvalidSearchQuery
+			}
+			query.Tags = append(query.Tags, value)
+		case "before", "after":
+			t, err := parseSearchDate(value)
+			if err != nil {
+				return nil, ErrInvalidSearchQuery
+			}
+			if op == "before" {
+				query.Before = t
+			} else {
+				query.After = t
+			}
+		default:
+			if strings.HasPrefix(token, "#") && len(token) > 1 {
+				query.Tags = append(query.Tags, strings.ToLower(token[1:]))
+				continue
+			}
+			query.Words = append(query.Words, searchWords(token)...)
+		}
+	}
+
+	if len(query.keys()) == 0 {
+		return nil, ErrInvalidSearchQuery
+	}
+
+	return query, nil
+}
+
+// keys returns the index keys every twt matching the query must have
+func (query *SearchQuery) keys() []string {
+	var keys []string
+
+	keys = append(keys, query.Words...)
+	for _, phrase := range query.Phrases {
+		keys = append(keys, strings.Fields(phrase)...)
+	}
+	for _, nick := range query.From {
+		keys = append(keys, "from:"+nick)
+	}
+	for _, nick := range query.Mentions {
+		keys = append(keys, "mentions:"+nick)
+	}
+	for _, tag := range query.Tags {
+		keys = append(keys, "tag:"+tag)
+	}
+
+	return keys
+}
+
+// Match returns true if the twt matches all of the query
+func (query *SearchQuery) Match(twt types.Twt) bool {
+	if !query.Before.IsZero() && !twt.Created().Before(query.Before) {
+		return false
+	}
+	if !query.After.IsZero() && !twt.Created().After(query.After) {
+		return false
+	}
+
+	keys := make(map[string]bool)
+	for _, key := range twtSearchKeys(twt) {
+		keys[key] = true
+	}
+	for _, key := range query.keys() {
+		if !keys[key] {
+			return false
+		}
+	}
+
+	if len(query.Phrases) > 0 {
+		text := " " + strings.Join(searchWords(twt.Text()), " ") + " "
+		for _, phrase := range query.Phrases {
+			if !strings.Contains(text, " "+phrase+" ") {
+				return false
+			}
+		}
+	}
+
+	return true
+}
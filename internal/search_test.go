@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	query, err := ParseSearchQuery(`Hello "Brave new  World" from:@Alice mentions:bob tag:Go #twtxt after:2020-12-01 before:2020-12-31T12:00:00Z`)
+	assert.NoError(err)
+	assert.Equal([]string{"hello"}, query.Words)
+	assert.Equal([]string{"brave new world"}, query.Phrases)
+	assert.Equal([]string{"alice"}, query.From)
+	assert.Equal([]string{"bob"}, query.Mentions)
+	assert.Equal([]string{"go", "twtxt"}, query.Tags)
+	assert.Equal(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC), query.After)
+	assert.Equal(time.Date(2020, 12, 31, 12, 0, 0, 0, time.UTC), query.Before)
+
+	for _, q := range []string{"", "   ", "after:2020-12-01", "before:yesterday", "from:", `""`} {
+		_, err := ParseSearchQuery(q)
+		assert.Equal(ErrInvalidSearchQuery, err, q)
+	}
+}
+
+func TestCache_Search(t *testing.T) {
+	assert := assert.New(t)
+
+	alice := types.Twter{Nick: "alice", URL: "http://a/twtxt.txt"}
+	bob := types.Twter{Nick: "bob", URL: "http://b/twtxt.txt"}
+
+	hello := retwt.NewReTwt(alice, "Hello brave new world!", time.Date(2020, 12, 3, 0, 0, 0, 0, time.UTC))
+	reply := retwt.NewReTwt(bob, "@<alice http://a/twtxt.txt> a new world indeed #twtxt", time.Date(2020, 12, 2, 0, 0, 0, 0, time.UTC))
+	old := retwt.NewReTwt(alice, "The world is brave and new", time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC))
+
+	archive := testArchiver{}
+	assert.NoError(archive.Archive(old))
+
+	cache := &Cache{Twts: make(map[string]*Cached)}
+	cache.setCached(alice.URL, &Cached{Twts: types.Twts{hello}})
+	cache.setCached(bob.URL, &Cached{Twts: types.Twts{reply}})
+	cache.indexArchived(types.Twts{old})
+
+	search := func(q, cursor string, limit int) (types.Twts, string) {
+		query, err := ParseSearchQuery(q)
+		if !assert.NoError(err, q) {
+			t.FailNow()
+		}
+		twts, next, err := cache.Search(archive, query, cursor, limit)
+		assert.NoError(err, q)
+		return twts, next
+	}
+
+	twts, _ := search("new world", "", 0)
+	assert.Equal([]string{hello.Hash(), reply.Hash(), old.Hash()}, hashes(twts))
+
+	twts, _ = search(`"new world"`, "", 0)
+	assert.Equal([]string{hello.Hash(), reply.Hash()}, hashes(twts))
+
+	twts, _ = search("world from:alice", "", 0)
+	assert.Equal([]string{hello.Hash(), old.Hash()}, hashes(twts))
+
+	twts, _ = search("mentions:alice", "", 0)
+	assert.Equal([]string{reply.Hash()}, hashes(twts))
+
+	twts, _ = search("tag:twtxt", "", 0)
+	assert.Equal([]string{reply.Hash()}, hashes(twts))
+
+	twts, _ = search("world before:2020-12-03", "", 0)
+	assert.Equal([]string{reply.Hash(), old.Hash()}, hashes(twts))
+
+	twts, _ = search("world after:2020-12-01", "", 0)
+	assert.Equal([]string{hello.Hash(), reply.Hash()}, hashes(twts))
+
+	twts, _ = search("goodbye", "", 0)
+	assert.Empty(twts)
+
+	// Results are paged by cursor
+	twts, cursor := search("world", "", 2)
+	assert.Equal([]string{hello.Hash(), reply.Hash()}, hashes(twts))
+	assert.Equal(reply.Hash(), cursor)
+	twts, cursor = search("world", cursor, 2)
+	assert.Equal([]string{old.Hash()}, hashes(twts))
+	assert.Equal("", cursor)
+}
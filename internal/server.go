@@ -17,7 +17,6 @@ import (
 	"github.com/NYTimes/gziphandler"
 	"github.com/andyleap/microformats"
 	humanize "github.com/dustin/go-humanize"
-	"github.com/gabstv/merger"
 	"github.com/prologic/observe"
 	"github.com/robfig/cron"
 	log "github.com/sirupsen/logrus"
@@ -28,6 +27,7 @@ import (
 	"github.com/jointwt/twtxt/internal/passwords"
 	"github.com/jointwt/twtxt/internal/session"
 	"github.com/jointwt/twtxt/internal/webmention"
+	"github.com/jointwt/twtxt/types"
 )
 
 var (
@@ -360,7 +360,7 @@ func (s *Server) processWebMention(source, target *url.URL, sourceData *microfor
 
 	if authorName != "" && sourceFeed != "" {
 		if _, err := AppendSpecial(
-			s.config, s.db,
+			s.config, s.cache.feedWriter, s.db,
 			twtxtBot,
 			fmt.Sprintf(
 				"MENTION: @<%s %s> from @<%s %s> on %s",
@@ -371,9 +371,14 @@ func (s *Server) processWebMention(source, target *url.URL, sourceData *microfor
 			log.WithError(err).Warnf("error appending special MENTION post")
 			return err
 		}
+
+		// The source feed has changed, refetch it now rather than waiting for
+		// its next poll
+		sources := types.Feeds{types.Feed{Nick: authorName, URL: sourceFeed}: true}
+		s.cache.FetchTwts(s.config, s.archive, sources, nil)
 	} else {
 		if _, err := AppendSpecial(
-			s.config, s.db,
+			s.config, s.cache.feedWriter, s.db,
 			twtxtBot,
 			fmt.Sprintf(
 				"WEBMENTION: @<%s %s> on %s",
@@ -394,6 +399,18 @@ func (s *Server) setupWebMentions() {
 	webmentions.Mention = s.processWebMention
 }
 
+// setupFeedWriter loads local feeds into the cache as soon as they are
+// written so that new twts show up on timelines right away
+func (s *Server) setupFeedWriter() {
+	feeds := filepath.Join(s.config.Data, feedsDir)
+	s.cache.feedWriter.Written = func(fn string) {
+		if filepath.Dir(fn) != feeds {
+			return
+		}
+		s.cache.LoadFeed(s.config, s.archive, filepath.Base(fn))
+	}
+}
+
 func (s *Server) setupCronJobs() error {
 	for name, jobSpec := range Jobs {
 		if jobSpec.Schedule == "" {
@@ -458,6 +475,9 @@ func (s *Server) initRoutes() {
 	s.router.GET("/mentions", s.am.MustAuth(s.MentionsHandler()))
 	s.router.GET("/search", s.SearchHandler())
 
+	s.router.GET("/lint", s.LintHandler())
+	s.router.POST("/lint", s.LintHandler())
+
 	s.router.HEAD("/twt/:hash", s.PermalinkHandler())
 	s.router.GET("/twt/:hash", s.PermalinkHandler())
 
@@ -499,6 +519,8 @@ func (s *Server) initRoutes() {
 	s.router.HEAD("/user/:nick/avatar", s.AvatarHandler())
 	s.router.HEAD("/user/:nick/twtxt.txt", s.TwtxtHandler())
 	s.router.GET("/user/:nick/twtxt.txt", s.TwtxtHandler())
+	s.router.HEAD("/user/:nick/archive/:name", s.FeedArchiveHandler())
+	s.router.GET("/user/:nick/archive/:name", s.FeedArchiveHandler())
 	s.router.GET("/user/:nick/followers", s.FollowersHandler())
 	s.router.GET("/user/:nick/following", s.FollowingHandler())
 
@@ -595,22 +617,9 @@ func (s *Server) initRoutes() {
 
 // NewServer ...
 func NewServer(bind string, options ...Option) (*Server, error) {
-	config := NewConfig()
-
-	for _, opt := range options {
-		if err := opt(config); err != nil {
-			return nil, err
-		}
-	}
-
-	settings, err := LoadSettings(filepath.Join(config.Data, "settings.yaml"))
+	config, err := LoadConfig(options...)
 	if err != nil {
-		log.Warnf("error loading pod settings: %s", err)
-	} else {
-		if err := merger.MergeOverwrite(config, settings); err != nil {
-			log.WithError(err).Error("error merging pod settings")
-			return nil, err
-		}
+		return nil, err
 	}
 
 	blogs, err := LoadBlogsCache(config.Data)
@@ -625,15 +634,15 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		blogs.UpdateBlogs(config)
 	}
 
-	cache, err := LoadCache(config.Data)
+	archive, err := NewDiskArchiver(filepath.Join(config.Data, archiveDir))
 	if err != nil {
-		log.WithError(err).Error("error loading feed cache")
+		log.WithError(err).Error("error creating feed archiver")
 		return nil, err
 	}
 
-	archive, err := NewDiskArchiver(filepath.Join(config.Data, archiveDir))
+	cache, err := LoadCache(config.Data, archive, NewFeedWriter())
 	if err != nil {
-		log.WithError(err).Error("error creating feed archiver")
+		log.WithError(err).Error("error loading feed cache")
 		return nil, err
 	}
 
@@ -648,6 +657,16 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		return nil, err
 	}
 
+	report, err := NewMigrator(config, cache, archive, db).Run(false)
+	if err != nil {
+		log.WithError(err).Error("error migrating store")
+		return nil, err
+	}
+	log.Infof(
+		"store schema version %d (migrated from %d with %d changes)",
+		report.To, report.From, report.Changes(),
+	)
+
 	templates, err := NewTemplates(config, blogs, cache)
 	if err != nil {
 		log.WithError(err).Error("error loading templates")
@@ -739,6 +758,9 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 	server.setupWebMentions()
 	log.Infof("started webmentions processor")
 
+	server.setupFeedWriter()
+	log.Info("loading local feeds into the cache as they are written")
+
 	server.setupMetrics()
 	log.Infof("serving metrics endpoint at %s/metrics", server.config.BaseURL)
 
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const snapshotTempSuffix = ".tmp-"
+
+var (
+	ErrSnapshotCorrupt = errors.New("error: snapshot is corrupt")
+)
+
+// isSnapshotTemp reports whether name is a temporary file left behind by an
+// interrupted writeSnapshot
+func isSnapshotTemp(name string) bool {
+	return strings.Contains(name, snapshotTempSuffix)
+}
+
+// writeSnapshot atomically replaces the file fn with data prefixed by its
+// SHA256 checksum. The data is written to a temporary file in the same
+// directory, synced to disk and then renamed over fn so that a crash never
+// leaves a partially written snapshot behind.
+func writeSnapshot(fn string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(fn), filepath.Base(fn)+snapshotTempSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	sum := sha256.Sum256(data)
+	if _, err := f.Write(sum[:]); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), fn)
+}
+
+// readSnapshot reads a file written by writeSnapshot and returns its data
+// if the checksum matches, otherwise ErrSnapshotCorrupt is returned.
+func readSnapshot(fn string) ([]byte, error) {
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < sha256.Size {
+		return nil, ErrSnapshotCorrupt
+	}
+
+	data := buf[sha256.Size:]
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(sum[:], buf[:sha256.Size]) {
+		return nil, ErrSnapshotCorrupt
+	}
+
+	return data, nil
+}
+
+// storeSnapshot gob encodes v and writes it to the snapshot fn (see
+// writeSnapshot) or removes fn if v is nil
+func storeSnapshot(fn string, v interface{}) error {
+	if v == nil {
+		if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	b := new(bytes.Buffer)
+	if err := gob.NewEncoder(b).Encode(v); err != nil {
+		return err
+	}
+	return writeSnapshot(fn, b.Bytes())
+}
+
+// loadSnapshots calls load with the data of every snapshot in dir. Temporary
+// files left behind by writeSnapshot and snapshots that are corrupt or that
+// load fails to decode are removed.
+func loadSnapshots(dir string, load func(data []byte) error) error {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, fileInfo := range fileInfos {
+		fn := filepath.Join(dir, fileInfo.Name())
+
+		if isSnapshotTemp(fileInfo.Name()) {
+			os.Remove(fn)
+			continue
+		}
+
+		data, err := readSnapshot(fn)
+		if err != nil {
+			log.WithError(err).Errorf("error loading snapshot %s, removing it", fn)
+			os.Remove(fn)
+			continue
+		}
+
+		if err := load(data); err != nil {
+			log.WithError(err).Errorf("error decoding snapshot %s, removing it", fn)
+			os.Remove(fn)
+		}
+	}
+
+	return nil
+}
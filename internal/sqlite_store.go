@@ -0,0 +1,554 @@
+package internal
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3" // Register the sqlite3 database/sql driver
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/session"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT NOT NULL PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS feeds (
+	name       TEXT NOT NULL PRIMARY KEY,
+	url        TEXT NOT NULL DEFAULT '',
+	created_at DATETIME,
+	data       BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	username   TEXT NOT NULL PRIMARY KEY,
+	email      TEXT NOT NULL DEFAULT '',
+	url        TEXT NOT NULL DEFAULT '',
+	created_at DATETIME,
+	data       BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	sid        TEXT NOT NULL PRIMARY KEY,
+	username   TEXT NOT NULL DEFAULT '',
+	expires_at DATETIME,
+	data       BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_username ON sessions (username);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+
+CREATE TABLE IF NOT EXISTS tokens (
+	signature  TEXT NOT NULL PRIMARY KEY,
+	expires_at DATETIME,
+	data       BLOB NOT NULL
+);
+`
+
+// sqliteSearchFeeds and sqliteSearchUsers select the feeds and users whose
+// name starts with ?1, see search()
+const (
+	sqliteSearchFeeds = `SELECT name FROM feeds WHERE name >= ?1 AND name < ?1 || x'ff' ORDER BY name`
+	sqliteSearchUsers = `SELECT username FROM users WHERE username >= ?1 AND username < ?1 || x'ff' ORDER BY username`
+)
+
+// sqlExecer is implemented by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// SQLiteStore ...
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only supports a single writer; serialize access through one
+	// connection to avoid "database is locked" errors under load.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (ss *SQLiteStore) count(table string) int64 {
+	var count int64
+
+	if err := ss.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		log.WithError(err).Errorf("error counting %s", table)
+	}
+
+	return count
+}
+
+// search returns the keys selected by query which are those starting with the
+// prefix bound to ?1. Like the other stores the match is case-sensitive.
+// Queries select the keys between ?1 and ?1 || x'ff' (which sorts after every
+// UTF-8 string starting with ?1) so that they are a range scan of the primary
+// key.
+func (ss *SQLiteStore) search(query, prefix string) []string {
+	var keys []string
+
+	rows, err := ss.db.Query(query, prefix)
+	if err != nil {
+		log.WithError(err).Error("error searching")
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			log.WithError(err).Error("error scanning")
+			return keys
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		log.WithError(err).Error("error searching")
+	}
+
+	return keys
+}
+
+// Sync ...
+func (ss *SQLiteStore) Sync() error {
+	_, err := ss.db.Exec("PRAGMA wal_checkpoint(PASSIVE)")
+	return err
+}
+
+// Close ...
+func (ss *SQLiteStore) Close() error {
+	log.Info("syncing store ...")
+	if _, err := ss.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		log.WithError(err).Error("error syncing store")
+		return err
+	}
+
+	log.Info("closing store ...")
+	if err := ss.db.Close(); err != nil {
+		log.WithError(err).Error("error closing store")
+		return err
+	}
+
+	return nil
+}
+
+// Merge ...
+func (ss *SQLiteStore) Merge() error {
+	log.Info("merging store ...")
+	if _, err := ss.db.Exec("VACUUM"); err != nil {
+		log.WithError(err).Error("error merging store")
+		return err
+	}
+
+	return nil
+}
+
+// GetSchemaVersion ...
+func (ss *SQLiteStore) GetSchemaVersion() (int, error) {
+	var version int
+	err := ss.db.QueryRow("SELECT CAST(value AS INTEGER) FROM meta WHERE key = 'schema_version'").Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// SetSchemaVersion ...
+func (ss *SQLiteStore) SetSchemaVersion(version int) error {
+	_, err := ss.db.Exec(
+		`INSERT INTO meta (key, value) VALUES ('schema_version', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`,
+		version,
+	)
+	return err
+}
+
+// Commit applies the batch in a single transaction
+func (ss *SQLiteStore) Commit(batch *Batch) error {
+	if err := batch.validate(); err != nil {
+		return err
+	}
+
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	for _, op := range batch.Ops {
+		if op.Data == nil {
+			var query string
+			switch op.Kind {
+			case batchFeeds:
+				query = "DELETE FROM feeds WHERE name = ?"
+			case batchUsers:
+				query = "DELETE FROM users WHERE username = ?"
+			case batchTokens:
+				query = "DELETE FROM tokens WHERE signature = ?"
+			}
+			if _, err := tx.Exec(query, op.Key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch op.Kind {
+		case batchFeeds:
+			feed, err := LoadFeed(op.Data)
+			if err != nil {
+				return err
+			}
+			if err := putFeed(tx, op.Key, feed, op.Data); err != nil {
+				return err
+			}
+		case batchUsers:
+			user, err := LoadUser(op.Data)
+			if err != nil {
+				return err
+			}
+			if err := putUser(tx, op.Key, user, op.Data); err != nil {
+				return err
+			}
+		case batchTokens:
+			tkn, err := LoadToken(op.Data)
+			if err != nil {
+				return err
+			}
+			if err := putToken(tx, op.Key, tkn, op.Data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ss *SQLiteStore) HasFeed(name string) bool {
+	var n int
+	err := ss.db.QueryRow("SELECT 1 FROM feeds WHERE name = ?", name).Scan(&n)
+	return err == nil
+}
+
+func (ss *SQLiteStore) DelFeed(name string) error {
+	_, err := ss.db.Exec("DELETE FROM feeds WHERE name = ?", name)
+	return err
+}
+
+func (ss *SQLiteStore) GetFeed(name string) (*Feed, error) {
+	var data []byte
+	err := ss.db.QueryRow("SELECT data FROM feeds WHERE name = ?", name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrFeedNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadFeed(data)
+}
+
+func (ss *SQLiteStore) SetFeed(name string, feed *Feed) error {
+	data, err := feed.Bytes()
+	if err != nil {
+		return err
+	}
+
+	return putFeed(ss.db, name, feed, data)
+}
+
+func putFeed(ex sqlExecer, name string, feed *Feed, data []byte) error {
+	_, err := ex.Exec(
+		`INSERT INTO feeds (name, url, created_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			url = excluded.url, created_at = excluded.created_at, data = excluded.data`,
+		name, feed.URL, feed.CreatedAt, data,
+	)
+	return err
+}
+
+func (ss *SQLiteStore) LenFeeds() int64 {
+	return ss.count("feeds")
+}
+
+func (ss *SQLiteStore) SearchFeeds(prefix string) []string {
+	return ss.search(
+		sqliteSearchFeeds,
+		prefix,
+	)
+}
+
+func (ss *SQLiteStore) GetAllFeeds() ([]*Feed, error) {
+	var feeds []*Feed
+
+	rows, err := ss.db.Query("SELECT data FROM feeds ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		feed, err := LoadFeed(data)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return feeds, nil
+}
+
+func (ss *SQLiteStore) HasUser(username string) bool {
+	var n int
+	err := ss.db.QueryRow("SELECT 1 FROM users WHERE username = ?", username).Scan(&n)
+	return err == nil
+}
+
+func (ss *SQLiteStore) DelUser(username string) error {
+	_, err := ss.db.Exec("DELETE FROM users WHERE username = ?", username)
+	return err
+}
+
+func (ss *SQLiteStore) GetUser(username string) (*User, error) {
+	var data []byte
+	err := ss.db.QueryRow("SELECT data FROM users WHERE username = ?", username).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadUser(data)
+}
+
+func (ss *SQLiteStore) SetUser(username string, user *User) error {
+	data, err := user.Bytes()
+	if err != nil {
+		return err
+	}
+
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	if err := putUser(tx, username, user, data); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func putUser(ex sqlExecer, username string, user *User, data []byte) error {
+	if _, err := ex.Exec(
+		`INSERT INTO users (username, email, url, created_at, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET
+			email = excluded.email, url = excluded.url,
+			created_at = excluded.created_at, data = excluded.data`,
+		username, user.Email, user.URL, user.CreatedAt, data,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (ss *SQLiteStore) LenUsers() int64 {
+	return ss.count("users")
+}
+
+func (ss *SQLiteStore) SearchUsers(prefix string) []string {
+	return ss.search(
+		sqliteSearchUsers,
+		prefix,
+	)
+}
+
+func (ss *SQLiteStore) GetAllUsers() ([]*User, error) {
+	var users []*User
+
+	rows, err := ss.db.Query("SELECT data FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		user, err := LoadUser(data)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (ss *SQLiteStore) GetSession(sid string) (*session.Session, error) {
+	var data []byte
+	err := ss.db.QueryRow("SELECT data FROM sessions WHERE sid = ?", sid).Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, session.ErrSessionNotFound
+		}
+		return nil, err
+	}
+	sess := session.NewSession(ss)
+	if err := session.LoadSession(data, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (ss *SQLiteStore) SetSession(sid string, sess *session.Session) error {
+	data, err := sess.Bytes()
+	if err != nil {
+		return err
+	}
+
+	username, _ := sess.Get("username")
+
+	_, err = ss.db.Exec(
+		`INSERT INTO sessions (sid, username, expires_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (sid) DO UPDATE SET
+			username = excluded.username, expires_at = excluded.expires_at,
+			data = excluded.data`,
+		sid, username, sess.ExpiresAt, data,
+	)
+	return err
+}
+
+func (ss *SQLiteStore) HasSession(sid string) bool {
+	var n int
+	err := ss.db.QueryRow("SELECT 1 FROM sessions WHERE sid = ?", sid).Scan(&n)
+	return err == nil
+}
+
+func (ss *SQLiteStore) DelSession(sid string) error {
+	_, err := ss.db.Exec("DELETE FROM sessions WHERE sid = ?", sid)
+	return err
+}
+
+func (ss *SQLiteStore) SyncSession(sess *session.Session) error {
+	// Only persist sessions with a logged in user associated with an account
+	// This saves resources as we don't need to keep session keys around for
+	// sessions we may never load from the store again.
+	if sess.Has("username") {
+		return ss.SetSession(sess.ID, sess)
+	}
+	return nil
+}
+
+func (ss *SQLiteStore) LenSessions() int64 {
+	return ss.count("sessions")
+}
+
+func (ss *SQLiteStore) GetAllSessions() ([]*session.Session, error) {
+	var sessions []*session.Session
+
+	rows, err := ss.db.Query("SELECT data FROM sessions")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		sess := session.NewSession(ss)
+		if err := session.LoadSession(data, sess); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// GetUserTokens returns the tokens in the user's list of tokens like the
+// other stores do
+func (ss *SQLiteStore) GetUserTokens(user *User) ([]*Token, error) {
+	tokens := []*Token{}
+	for _, signature := range user.Tokens {
+		tkn, err := ss.GetToken(signature)
+		if err != nil {
+			return tokens, err
+		}
+
+		tokens = append(tokens, tkn)
+	}
+
+	return tokens, nil
+}
+
+func (ss *SQLiteStore) GetToken(signature string) (*Token, error) {
+	var data []byte
+	err := ss.db.QueryRow("SELECT data FROM tokens WHERE signature = ?", signature).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadToken(data)
+}
+
+func (ss *SQLiteStore) SetToken(signature string, tkn *Token) error {
+	data, err := tkn.Bytes()
+	if err != nil {
+		return err
+	}
+
+	return putToken(ss.db, signature, tkn, data)
+}
+
+func putToken(ex sqlExecer, signature string, tkn *Token, data []byte) error {
+	// Tokens are persisted before the owning user is updated (see
+	// User.AddToken); the username column is filled in by SetUser.
+	_, err := ex.Exec(
+		`INSERT INTO tokens (signature, expires_at, data) VALUES (?, ?, ?)
+		ON CONFLICT (signature) DO UPDATE SET
+			expires_at = excluded.expires_at, data = excluded.data`,
+		signature, tkn.ExpiresAt, data,
+	)
+	return err
+}
+
+func (ss *SQLiteStore) DelToken(signature string) error {
+	_, err := ss.db.Exec("DELETE FROM tokens WHERE signature = ?", signature)
+	return err
+}
+
+func (ss *SQLiteStore) LenTokens() int64 {
+	return ss.count("tokens")
+}
@@ -165,6 +165,11 @@ function editTwt(e) {
   text.setSelectionRange(size, size);
 
   u("#replaceTwt").first().value = u(e.target).data("hash");
+
+  var postas = u("#postas");
+  if (postas.length) {
+    postas.first().value = u(e.target).data("feed");
+  }
 }
 
 function deleteTwt(e) {
@@ -173,11 +178,18 @@ function deleteTwt(e) {
   if (
     confirm("Are you sure you want to delete this twt? This cannot be undone!")
   ) {
+    var hash = u(e.target).data("hash");
+    var feed = u(e.target).data("feed");
+
     Twix.ajax({
       type: "DELETE",
-      url: u("#form").attr("action"),
+      url:
+        u("#form").attr("action") +
+        "?hash=" +
+        encodeURIComponent(hash) +
+        "&postas=" +
+        encodeURIComponent(feed),
       success: function (data) {
-        var hash = u(e.target).data("hash");
         u("#" + hash).remove();
       },
     });
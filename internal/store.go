@@ -13,6 +13,7 @@ var (
 	ErrTokenNotFound  = errors.New("error: token not found")
 	ErrFeedNotFound   = errors.New("error: feed not found")
 	ErrInvalidSession = errors.New("error: invalid session")
+	ErrInvalidBatchOp = errors.New("error: invalid batch operation")
 )
 
 type Store interface {
@@ -20,6 +21,12 @@ type Store interface {
 	Close() error
 	Sync() error
 
+	GetSchemaVersion() (int, error)
+	SetSchemaVersion(version int) error
+
+	// Commit applies all operations in the batch all-or-nothing
+	Commit(batch *Batch) error
+
 	DelFeed(name string) error
 	HasFeed(name string) bool
 	GetFeed(name string) (*Feed, error)
@@ -50,6 +57,104 @@ type Store interface {
 	LenTokens() int64
 }
 
+const (
+	batchFeeds  = "feeds"
+	batchUsers  = "users"
+	batchTokens = "tokens"
+)
+
+// BatchOp is a single Set (Data is non-nil) or Del (Data is nil) operation
+// on a feed, user or token in a Batch.
+type BatchOp struct {
+	Kind string
+	Key  string
+	Data []byte
+}
+
+// Batch is a group of Set/Del operations on feeds, users and tokens that is
+// applied to a Store all-or-nothing with Store.Commit. Operations are applied
+// in the order they were added to the batch.
+type Batch struct {
+	Ops []BatchOp
+}
+
+// NewBatch ...
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Len returns the number of operations in the batch
+func (b *Batch) Len() int {
+	return len(b.Ops)
+}
+
+func (b *Batch) set(kind, key string, data []byte) {
+	b.Ops = append(b.Ops, BatchOp{Kind: kind, Key: key, Data: data})
+}
+
+func (b *Batch) del(kind, key string) {
+	b.Ops = append(b.Ops, BatchOp{Kind: kind, Key: key})
+}
+
+func (b *Batch) validate() error {
+	for _, op := range b.Ops {
+		switch op.Kind {
+		case batchFeeds, batchUsers, batchTokens:
+		default:
+			return ErrInvalidBatchOp
+		}
+		if op.Key == "" {
+			return ErrInvalidBatchOp
+		}
+	}
+	return nil
+}
+
+// SetFeed ...
+func (b *Batch) SetFeed(name string, feed *Feed) error {
+	data, err := feed.Bytes()
+	if err != nil {
+		return err
+	}
+	b.set(batchFeeds, name, data)
+	return nil
+}
+
+// DelFeed ...
+func (b *Batch) DelFeed(name string) {
+	b.del(batchFeeds, name)
+}
+
+// SetUser ...
+func (b *Batch) SetUser(username string, user *User) error {
+	data, err := user.Bytes()
+	if err != nil {
+		return err
+	}
+	b.set(batchUsers, username, data)
+	return nil
+}
+
+// DelUser ...
+func (b *Batch) DelUser(username string) {
+	b.del(batchUsers, username)
+}
+
+// SetToken ...
+func (b *Batch) SetToken(signature string, token *Token) error {
+	data, err := token.Bytes()
+	if err != nil {
+		return err
+	}
+	b.set(batchTokens, signature, data)
+	return nil
+}
+
+// DelToken ...
+func (b *Batch) DelToken(signature string) {
+	b.del(batchTokens, signature)
+}
+
 func NewStore(store string) (Store, error) {
 	u, err := ParseURI(store)
 	if err != nil {
@@ -59,6 +164,10 @@ func NewStore(store string) (Store, error) {
 	switch u.Type {
 	case "bitcask":
 		return newBitcaskStore(u.Path)
+	case "sqlite":
+		return newSQLiteStore(u.Path)
+	case "memory":
+		return newMemoryStore(), nil
 	default:
 		return nil, ErrInvalidStore
 	}
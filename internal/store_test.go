@@ -0,0 +1,273 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/internal/session"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twtxt-store-*")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, uri := range []string{
+		"memory://",
+		"bitcask://" + filepath.Join(dir, "twtxt.db"),
+		"sqlite://" + filepath.Join(dir, "twtxt.sqlite"),
+	} {
+		uri := uri
+		t.Run(strings.Split(uri, ":")[0], func(t *testing.T) {
+			db, err := NewStore(uri)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer db.Close()
+
+			testStore(t, db)
+		})
+	}
+}
+
+// testStore exercises a Store, every store must pass it the same
+func testStore(t *testing.T, db Store) {
+	t.Run("Users", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.False(db.HasUser("alice"))
+		_, err := db.GetUser("alice")
+		assert.Equal(ErrUserNotFound, err)
+
+		assert.NoError(db.SetUser("alice", &User{Username: "alice", Tokens: []string{"sig"}}))
+		assert.NoError(db.SetUser("alex", &User{Username: "alex"}))
+		assert.NoError(db.SetUser("bob", &User{Username: "bob"}))
+
+		assert.True(db.HasUser("alice"))
+		assert.Equal(int64(3), db.LenUsers())
+		assert.Equal([]string{"alex", "alice"}, db.SearchUsers("al"))
+		assert.Empty(db.SearchUsers("Al"))
+		assert.Empty(db.SearchUsers("al%"))
+		assert.Equal([]string{"alex", "alice", "bob"}, db.SearchUsers(""))
+
+		user, err := db.GetUser("alice")
+		assert.NoError(err)
+		assert.Equal("alice", user.Username)
+
+		// Mutating a loaded user must not affect the stored copy
+		user.Tagline = "changed"
+		user, err = db.GetUser("alice")
+		assert.NoError(err)
+		assert.Equal("", user.Tagline)
+
+		assert.NoError(db.SetToken("sig", &Token{Signature: "sig"}))
+		tokens, err := db.GetUserTokens(user)
+		assert.NoError(err)
+		assert.Len(tokens, 1)
+
+		assert.NoError(db.DelUser("bob"))
+		assert.False(db.HasUser("bob"))
+	})
+
+	t.Run("Feeds", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.NoError(db.SetFeed("news", &Feed{Name: "news"}))
+		assert.True(db.HasFeed("news"))
+		assert.Equal([]string{"news"}, db.SearchFeeds("ne"))
+		assert.Empty(db.SearchFeeds("NE"))
+
+		feeds, err := db.GetAllFeeds()
+		assert.NoError(err)
+		assert.Len(feeds, 1)
+
+		assert.NoError(db.DelFeed("news"))
+		_, err = db.GetFeed("news")
+		assert.Equal(ErrFeedNotFound, err)
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		sess := session.NewSession(db)
+		sess.ID = "sid"
+		sess.Data = session.Map{}
+
+		// Anonymous sessions are not persisted
+		assert.NoError(db.SyncSession(sess))
+		assert.False(db.HasSession("sid"))
+
+		sess.Data["username"] = "alice"
+		assert.NoError(db.SyncSession(sess))
+		assert.True(db.HasSession("sid"))
+
+		loaded, err := db.GetSession("sid")
+		assert.NoError(err)
+		assert.Equal("alice", loaded.Data["username"])
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.NoError(db.SetFeed("old", &Feed{Name: "old"}))
+
+		batch := NewBatch()
+		assert.NoError(batch.SetUser("carol", &User{Username: "carol"}))
+		assert.NoError(batch.SetFeed("new", &Feed{Name: "new"}))
+		batch.DelFeed("old")
+		assert.Equal(3, batch.Len())
+
+		assert.NoError(db.Commit(batch))
+		assert.True(db.HasUser("carol"))
+		assert.True(db.HasFeed("new"))
+		assert.False(db.HasFeed("old"))
+
+		// Invalid batches are rejected without applying anything
+		batch = NewBatch()
+		batch.DelUser("carol")
+		batch.Ops = append(batch.Ops, BatchOp{Kind: "invalid", Key: "x"})
+		assert.Equal(ErrInvalidBatchOp, db.Commit(batch))
+		assert.True(db.HasUser("carol"))
+
+		// Batches (and records) larger than bitcask's default 64KB values
+		batch = NewBatch()
+		for i := 0; i < 100; i++ {
+			name := fmt.Sprintf("user%d", i)
+			assert.NoError(batch.SetUser(name, &User{Username: name, Tagline: strings.Repeat("x", 1024)}))
+		}
+		assert.NoError(batch.SetUser("dave", &User{Username: "dave", Tagline: strings.Repeat("x", 100*1024)}))
+		assert.NoError(db.Commit(batch))
+		assert.True(db.HasUser("user99"))
+
+		user, err := db.GetUser("dave")
+		assert.NoError(err)
+		assert.Len(user.Tagline, 100*1024)
+	})
+}
+
+func TestBitcaskStore_RecoverBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "twtxt-store-*")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	bs, err := newBitcaskStore(dir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	journal := func(n int, op BatchOp) {
+		data, err := json.Marshal(op)
+		assert.NoError(err)
+		assert.NoError(bs.db.Put(journalKey(n), data))
+	}
+
+	// A batch journaled in full but not applied is applied on open
+	journal(0, BatchOp{Kind: "users", Key: "alice", Data: []byte(`{"Username":"alice"}`)})
+	journal(1, BatchOp{Kind: "feeds", Key: "news", Data: []byte(`{"Name":"news"}`)})
+	assert.NoError(bs.db.Put([]byte(batchJournalKey), []byte("2")))
+	assert.NoError(bs.Close())
+
+	bs, err = newBitcaskStore(dir)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.True(bs.HasUser("alice"))
+	assert.True(bs.HasFeed("news"))
+	assert.False(bs.db.Has([]byte(batchJournalKey)))
+	assert.False(bs.db.Has(journalKey(0)))
+
+	// A batch journaled in part was never applied and is discarded
+	journal(0, BatchOp{Kind: "users", Key: "bob", Data: []byte(`{"Username":"bob"}`)})
+	assert.NoError(bs.Close())
+
+	bs, err = newBitcaskStore(dir)
+	if !assert.NoError(err) {
+		return
+	}
+	defer bs.Close()
+	assert.False(bs.HasUser("bob"))
+	assert.False(bs.db.Has(journalKey(0)))
+}
+
+func TestBitcaskStore_CommitRollback(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "twtxt-store-*")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	bs, err := newBitcaskStore(dir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.NoError(bs.SetUser("alice", &User{Username: "alice", URL: "a"}))
+
+	// A key too large for bitcask fails only once the batch is applied
+	batch := NewBatch()
+	assert.NoError(batch.SetUser("alice", &User{Username: "alice", URL: "b"}))
+	assert.NoError(batch.SetUser("bob", &User{Username: "bob"}))
+	assert.NoError(batch.SetFeed(strings.Repeat("x", 300), &Feed{}))
+	assert.Error(bs.Commit(batch))
+
+	user, err := bs.GetUser("alice")
+	assert.NoError(err)
+	assert.Equal("a", user.URL)
+	assert.False(bs.HasUser("bob"))
+	assert.False(bs.db.Has([]byte(batchJournalKey)))
+	assert.False(bs.db.Has(journalKey(0)))
+
+	// The failed batch is never replayed over later writes
+	assert.NoError(bs.SetUser("alice", &User{Username: "alice", URL: "c"}))
+	batch = NewBatch()
+	assert.NoError(batch.SetFeed("news", &Feed{Name: "news"}))
+	assert.NoError(bs.Commit(batch))
+	assert.NoError(bs.Close())
+
+	bs, err = newBitcaskStore(dir)
+	if !assert.NoError(err) {
+		return
+	}
+	defer bs.Close()
+
+	user, err = bs.GetUser("alice")
+	assert.NoError(err)
+	assert.Equal("c", user.URL)
+	assert.False(bs.HasUser("bob"))
+	assert.True(bs.HasFeed("news"))
+}
+
+func TestSQLiteStore_SearchUsesIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "twtxt-store-*")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	ss, err := newSQLiteStore(filepath.Join(dir, "twtxt.sqlite"))
+	if !assert.NoError(err) {
+		return
+	}
+	defer ss.Close()
+
+	for _, query := range []string{sqliteSearchFeeds, sqliteSearchUsers} {
+		var (
+			id, parent, notused int
+			detail              string
+		)
+		err := ss.db.QueryRow("EXPLAIN QUERY PLAN "+query, "al").Scan(&id, &parent, &notused, &detail)
+		assert.NoError(err)
+		assert.Contains(detail, "SEARCH", query)
+	}
+}
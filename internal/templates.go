@@ -37,6 +37,7 @@ func NewTemplates(conf *Config, blogs *BlogsCache, cache *Cache) (*Templates, er
 	funcMap["hostnameFromURL"] = HostnameFromURL
 	funcMap["prettyURL"] = PrettyURL
 	funcMap["isLocalURL"] = IsLocalURLFactory(conf)
+	funcMap["editableFeed"] = EditableFeedFactory(conf)
 	funcMap["formatTwt"] = FormatTwtFactory(conf)
 	funcMap["unparseTwt"] = UnparseTwtFactory(conf)
 	funcMap["formatForDateTime"] = FormatForDateTime
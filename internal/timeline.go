@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"sort"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+// timelineEntry is a twt in the timeline along with the url of the feed it
+// is cached under
+type timelineEntry struct {
+	url string
+	twt types.Twt
+}
+
+// timeline is every cached twt of every feed kept sorted newest first (see
+// twtBefore) and updated incrementally as feeds are fetched, so timelines
+// can be filtered from it without collecting and sorting all of the twts
+// of every feed on every request.
+type timeline []timelineEntry
+
+// search returns the index of the first entry that does not sort before twt
+func (tl timeline) search(twt types.Twt) int {
+	return sort.Search(len(tl), func(i int) bool { return !twtBefore(tl[i].twt, twt) })
+}
+
+// find returns the index of twt of the feed url or -1 if it is not in the
+// timeline
+func (tl timeline) find(url string, twt types.Twt) int {
+	hash := twt.Hash()
+	for i := tl.search(twt); i < len(tl) && tl[i].twt.Hash() == hash; i++ {
+		if tl[i].url == url {
+			return i
+		}
+	}
+	return -1
+}
+
+// update replaces the twts (old) of the feed url with twts, merging the
+// twts that were added into the timeline in one pass
+func (tl *timeline) update(url string, old, twts types.Twts) {
+	// A feed can have the same twt more than once so count them
+	diff := make(map[string]int)
+	for _, twt := range twts {
+		diff[twt.Hash()]++
+	}
+	for _, twt := range old {
+		diff[twt.Hash()]--
+	}
+
+	removed := make(map[string]int)
+	for _, twt := range old {
+		if hash := twt.Hash(); diff[hash] < 0 {
+			removed[hash]++
+			diff[hash]++
+		}
+	}
+
+	var added types.Twts
+	current := make(map[string]types.Twt, len(twts))
+	for _, twt := range twts {
+		hash := twt.Hash()
+		if diff[hash] > 0 {
+			added = append(added, twt)
+			diff[hash]--
+		} else {
+			current[hash] = twt
+		}
+	}
+
+	if len(added) == 0 && len(removed) == 0 {
+		for _, twt := range twts {
+			if i := tl.find(url, twt); i != -1 {
+				(*tl)[i].twt = twt
+			}
+		}
+		return
+	}
+
+	sort.Slice(added, func(i, j int) bool { return twtBefore(added[i], added[j]) })
+
+	merged := make(timeline, 0, len(*tl)+len(added))
+	for _, entry := range *tl {
+		// Added twts go before the first entry that does not sort before
+		// them, as search places them
+		for len(added) > 0 && !twtBefore(entry.twt, added[0]) {
+			merged = append(merged, timelineEntry{url: url, twt: added[0]})
+			added = added[1:]
+		}
+		if entry.url == url {
+			hash := entry.twt.Hash()
+			if removed[hash] > 0 {
+				removed[hash]--
+				continue
+			}
+			if twt, ok := current[hash]; ok {
+				entry.twt = twt
+			}
+		}
+		merged = append(merged, entry)
+	}
+	for _, twt := range added {
+		merged = append(merged, timelineEntry{url: url, twt: twt})
+	}
+
+	*tl = merged
+}
+
+// filter returns the twts (newest first) of the feeds whose url match,
+// skipping the first offset of them and stopping after limit twts unless
+// limit is 0
+func (tl timeline) filter(match func(url string) bool, offset, limit int) types.Twts {
+	var twts types.Twts
+	for _, entry := range tl {
+		if limit > 0 && len(twts) == limit {
+			break
+		}
+		if !match(entry.url) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		twts = append(twts, entry.twt)
+	}
+	return twts
+}
+
+// timelineAdapter pages through the timeline of feeds for a paginator,
+// filtering only the twts of the requested page
+type timelineAdapter struct {
+	cache *Cache
+	feeds types.Feeds
+}
+
+// Nums returns the number of twts in the timeline of the feeds
+func (a timelineAdapter) Nums() int {
+	return a.cache.CountTimeline(a.feeds)
+}
+
+// Slice stores the twts of the page at offset into data, a *types.Twts
+func (a timelineAdapter) Slice(offset, length int, data interface{}) error {
+	*data.(*types.Twts) = a.cache.GetTimeline(a.feeds, offset, length)
+	return nil
+}
@@ -3,6 +3,7 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -11,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	read_file_last_line "github.com/prologic/read-file-last-line"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/jointwt/twtxt/types"
@@ -21,6 +21,10 @@ const (
 	feedsDir = "feeds"
 )
 
+var (
+	ErrTwtNotFound = errors.New("error: twt not found in feed")
+)
+
 // ExpandMentions turns "@nick" into "@<nick URL>" if we're following the user or feed
 // or if they exist on the local pod. Also turns @user@domain into
 // @<user URL> as a convenient way to mention users across pods.
@@ -67,36 +71,13 @@ func ExpandTag(conf *Config, db Store, user *User, text string) string {
 	})
 }
 
-func DeleteLastTwt(conf *Config, user *User) error {
-	p := filepath.Join(conf.Data, feedsDir)
-	if err := os.MkdirAll(p, 0755); err != nil {
-		log.WithError(err).Error("error creating feeds directory")
-		return err
-	}
-
-	fn := filepath.Join(p, user.Username)
-
-	_, n, err := GetLastTwt(conf, user)
-	if err != nil {
-		return err
-	}
-
-	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	return f.Truncate(int64(n))
-}
-
-func AppendSpecial(conf *Config, db Store, specialUsername, text string, args ...interface{}) (types.Twt, error) {
+func AppendSpecial(conf *Config, feedWriter *FeedWriter, db Store, specialUsername, text string, args ...interface{}) (types.Twt, error) {
 	user := &User{Username: specialUsername}
 	user.Following = make(map[string]string)
-	return AppendTwt(conf, db, user, text, args)
+	return AppendTwt(conf, feedWriter, db, user, text, args)
 }
 
-func AppendTwt(conf *Config, db Store, user *User, text string, args ...interface{}) (types.Twt, error) {
+func AppendTwt(conf *Config, feedWriter *FeedWriter, db Store, user *User, text string, args ...interface{}) (types.Twt, error) {
 	text = strings.TrimSpace(text)
 	if text == "" {
 		return types.NilTwt, fmt.Errorf("cowardly refusing to twt empty text, or only spaces")
@@ -110,12 +91,6 @@ func AppendTwt(conf *Config, db Store, user *User, text string, args ...interfac
 
 	fn := filepath.Join(p, user.Username)
 
-	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		return types.NilTwt, err
-	}
-	defer f.Close()
-
 	// Support replacing/editing an existing Twt whilst preserving Created Timestamp
 	now := time.Now()
 	if len(args) == 1 {
@@ -130,7 +105,7 @@ func AppendTwt(conf *Config, db Store, user *User, text string, args ...interfac
 		ExpandTag(conf, db, user, ExpandMentions(conf, db, user, text)),
 	)
 
-	if _, err = f.WriteString(line); err != nil {
+	if err := feedWriter.Append(fn, []byte(line)); err != nil {
 		return types.NilTwt, err
 	}
 
@@ -142,37 +117,104 @@ func AppendTwt(conf *Config, db Store, user *User, text string, args ...interfac
 	return twt, nil
 }
 
-func FeedExists(conf *Config, username string) bool {
-	fn := filepath.Join(conf.Data, feedsDir, NormalizeUsername(username))
-	if _, err := os.Stat(fn); err != nil {
-		if os.IsNotExist(err) {
-			return false
+// rewriteTwt replaces the text of the twt with the given hash in the local
+// feed name, or in one of its archive files (see RotateFeed()), keeping its
+// timestamp or removes the twt if text is empty. The file is rewritten
+// atomically by the FeedWriter and the twt as it was and as it is now (if
+// not removed) are returned.
+func rewriteTwt(conf *Config, feedWriter *FeedWriter, name, hash, text string) (types.Twt, types.Twt, error) {
+	twter := types.Twter{
+		Nick: name,
+		URL:  URLForUser(conf, name),
+	}
+
+	var old, twt types.Twt = types.NilTwt, types.NilTwt
+
+	rewrite := func(data []byte) ([]byte, error) {
+		lines := strings.SplitAfter(string(data), "\n")
+		for i, line := range lines {
+			line = strings.TrimSpace(line)
+			t, err := types.ParseLine(line, twter)
+			if err != nil || t.IsZero() || t.Hash() != hash {
+				continue
+			}
+			old = t
+
+			if text == "" {
+				lines[i] = ""
+			} else {
+				// Keep the timestamp exactly as it was written
+				timestamp := line[:strings.IndexAny(line, " \t")]
+				lines[i] = fmt.Sprintf("%s\t%s\n", timestamp, text)
+				if twt, err = types.ParseLine(strings.TrimSpace(lines[i]), twter); err != nil {
+					return nil, err
+				}
+			}
+
+			return []byte(strings.Join(lines, "")), nil
 		}
+		return nil, ErrTwtNotFound
 	}
 
-	return true
+	err := feedWriter.Rewrite(filepath.Join(conf.Data, feedsDir, name), rewrite)
+	if err == ErrTwtNotFound {
+		// Look through the archive files only after the feed so that a twt
+		// being rotated out of the feed at the same time is not missed
+		fns, _ := filepath.Glob(filepath.Join(conf.Data, archivedFeedsDir, name, "*.txt"))
+		for _, fn := range fns {
+			if err = feedWriter.Rewrite(fn, rewrite); err != ErrTwtNotFound {
+				break
+			}
+		}
+	}
+	if err != nil {
+		if err != ErrTwtNotFound {
+			log.WithError(err).Errorf("error rewriting twt %s of feed %s", hash, name)
+		}
+		return types.NilTwt, types.NilTwt, err
+	}
+
+	return old, twt, nil
 }
 
-func GetLastTwt(conf *Config, user *User) (twt types.Twt, offset int, err error) {
-	twt = types.NilTwt
+// EditSpecial is EditTwt for twts of the local feed specialUsername
+func EditSpecial(conf *Config, feedWriter *FeedWriter, db Store, specialUsername, hash, text string) (types.Twt, types.Twt, error) {
+	user := &User{Username: specialUsername}
+	user.Following = make(map[string]string)
+	return EditTwt(conf, feedWriter, db, user, hash, text)
+}
 
-	p := filepath.Join(conf.Data, feedsDir)
-	if err = os.MkdirAll(p, 0755); err != nil {
-		log.WithError(err).Error("error creating feeds directory")
-		return
+// EditTwt replaces the text of the user's twt with the given hash whilst
+// preserving its Created timestamp and returns the twt as it was and as it is
+// now
+func EditTwt(conf *Config, feedWriter *FeedWriter, db Store, user *User, hash, text string) (types.Twt, types.Twt, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return types.NilTwt, types.NilTwt, fmt.Errorf("cowardly refusing to twt empty text, or only spaces")
 	}
 
-	fn := filepath.Join(p, user.Username)
+	return rewriteTwt(
+		conf, feedWriter, user.Username, hash,
+		ExpandTag(conf, db, user, ExpandMentions(conf, db, user, text)),
+	)
+}
 
-	var data []byte
-	data, offset, err = read_file_last_line.ReadLastLine(fn)
-	if err != nil {
-		return
-	}
+// DeleteTwt removes the twt with the given hash from the local feed name and
+// returns it
+func DeleteTwt(conf *Config, feedWriter *FeedWriter, name, hash string) (types.Twt, error) {
+	twt, _, err := rewriteTwt(conf, feedWriter, name, hash, "")
+	return twt, err
+}
 
-	twt, err = types.ParseLine(string(data), user.Twter())
+func FeedExists(conf *Config, username string) bool {
+	fn := filepath.Join(conf.Data, feedsDir, NormalizeUsername(username))
+	if _, err := os.Stat(fn); err != nil {
+		if os.IsNotExist(err) {
+			return false
+		}
+	}
 
-	return
+	return true
 }
 
 func GetAllFeeds(conf *Config) ([]string, error) {
@@ -190,6 +232,10 @@ func GetAllFeeds(conf *Config) ([]string, error) {
 
 	fns := []string{}
 	for _, fileInfo := range files {
+		// Skip temporary files left behind by an interrupted rewrite
+		if isSnapshotTemp(fileInfo.Name()) {
+			continue
+		}
 		fns = append(fns, filepath.Base(fileInfo.Name()))
 	}
 	return fns, nil
@@ -233,7 +279,7 @@ func GetAllTwts(conf *Config, name string) (types.Twts, error) {
 		log.WithError(err).Warnf("error opening feed: %s", fn)
 		return nil, err
 	}
-	t, _, err := types.ParseFile(f, twter, 0, 0)
+	t, _, _, err := types.ParseFile(f, twter, 0, 0)
 	if err != nil {
 		log.WithError(err).Errorf("error processing feed %s", fn)
 		return nil, err
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/retwt"
+)
+
+func TestEditDeleteTwt(t *testing.T) {
+	assert := assert.New(t)
+
+	retwt.DefaultTwtManager()
+
+	data, err := ioutil.TempDir("", "twtxt-twt-*")
+	assert.NoError(err)
+	defer os.RemoveAll(data)
+	assert.NoError(os.MkdirAll(filepath.Join(data, feedsDir), 0755))
+	assert.NoError(os.MkdirAll(filepath.Join(data, archivedFeedsDir, "news"), 0755))
+
+	w := NewFeedWriter()
+
+	conf := NewConfig()
+	conf.Data = data
+	conf.BaseURL = "http://0.0.0.0:8000"
+
+	db, err := NewStore("memory://")
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	fn := filepath.Join(data, feedsDir, "news")
+	assert.NoError(ioutil.WriteFile(fn, []byte(
+		"# prev = abcdefg archive/twtxt-2020-12-01.txt\n"+
+			"2020-12-02T10:00:00Z\tone\n"+
+			"2020-12-02T11:00:00+01:00\ttwo\n"+
+			"2020-12-02T12:00:00Z\tthree\n",
+	), 0644))
+	archived := filepath.Join(data, archivedFeedsDir, "news", "twtxt-2020-12-01.txt")
+	assert.NoError(ioutil.WriteFile(archived, []byte("2020-12-01T10:00:00Z\tzero\n"), 0644))
+
+	twter := types.Twter{Nick: "news", URL: URLForUser(conf, "news")}
+	parse := func(line string) types.Twt {
+		twt, err := types.ParseLine(line, twter)
+		assert.NoError(err)
+		return twt
+	}
+	read := func(fn string) string {
+		data, err := ioutil.ReadFile(fn)
+		assert.NoError(err)
+		return string(data)
+	}
+
+	t.Run("Edit", func(t *testing.T) {
+		two := parse("2020-12-02T11:00:00+01:00\ttwo")
+
+		old, twt, err := EditSpecial(conf, w, db, "news", two.Hash(), "second")
+		assert.NoError(err)
+		assert.Equal(two.Hash(), old.Hash())
+		assert.Equal("second", twt.Text())
+		assert.Equal(two.Created(), twt.Created())
+		assert.NotEqual(two.Hash(), twt.Hash())
+
+		assert.Equal(
+			"# prev = abcdefg archive/twtxt-2020-12-01.txt\n"+
+				"2020-12-02T10:00:00Z\tone\n"+
+				"2020-12-02T11:00:00+01:00\tsecond\n"+
+				"2020-12-02T12:00:00Z\tthree\n",
+			read(fn),
+		)
+	})
+
+	t.Run("EditArchived", func(t *testing.T) {
+		zero := parse("2020-12-01T10:00:00Z\tzero")
+
+		_, twt, err := EditSpecial(conf, w, db, "news", zero.Hash(), "nothing")
+		assert.NoError(err)
+		assert.Equal("nothing", twt.Text())
+		assert.Equal("2020-12-01T10:00:00Z\tnothing\n", read(archived))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		one := parse("2020-12-02T10:00:00Z\tone")
+
+		old, err := DeleteTwt(conf, w, "news", one.Hash())
+		assert.NoError(err)
+		assert.Equal(one.Hash(), old.Hash())
+
+		assert.Equal(
+			"# prev = abcdefg archive/twtxt-2020-12-01.txt\n"+
+				"2020-12-02T11:00:00+01:00\tsecond\n"+
+				"2020-12-02T12:00:00Z\tthree\n",
+			read(fn),
+		)
+
+		_, err = DeleteTwt(conf, w, "news", one.Hash())
+		assert.Equal(ErrTwtNotFound, err)
+	})
+}
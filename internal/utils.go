@@ -203,7 +203,59 @@ func ImageToPng(fn string) error {
 	return nil
 }
 
-func GetExternalAvatar(conf *Config, nick, uri string) string {
+// prefixedReaderAt reads prefix followed by r, used to serve a feed with its
+// metadata headers without copying it
+type prefixedReaderAt struct {
+	prefix []byte
+	r      io.ReaderAt
+}
+
+func (p *prefixedReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	var n int
+	if off < int64(len(p.prefix)) {
+		n = copy(b, p.prefix[off:])
+		if n == len(b) {
+			return n, nil
+		}
+		off = 0
+	} else {
+		off -= int64(len(p.prefix))
+	}
+	m, err := p.r.ReadAt(b[n:], off)
+	return n + m, err
+}
+
+// DownloadExternalAvatar downloads the avatar declared by the external feed at
+// uri in its metadata (see types.Metadata) replacing any previous avatar
+func DownloadExternalAvatar(conf *Config, uri, avatar string) error {
+	base, err := url.Parse(uri)
+	if err != nil {
+		log.WithError(err).Errorf("error parsing uri: %s", uri)
+		return err
+	}
+
+	source, err := base.Parse(avatar)
+	if err != nil {
+		log.WithError(err).Errorf("error parsing avatar %s declared by %s", avatar, uri)
+		return err
+	}
+
+	opts := &ImageOptions{Resize: true, Width: AvatarResolution, Height: AvatarResolution}
+	if _, err := DownloadImage(conf, source.String(), externalDir, Slugify(uri), opts); err != nil {
+		log.WithError(err).
+			WithField("uri", uri).
+			WithField("source", source.String()).
+			Error("error downloading declared external avatar")
+		return err
+	}
+
+	return nil
+}
+
+// GetExternalAvatar returns the url of the avatar of the external feed at uri,
+// downloading it if it has not been already. The avatar declared in the
+// feed's metadata (if any) is preferred to looking for one next to the feed.
+func GetExternalAvatar(conf *Config, nick, uri string, meta *types.Metadata) string {
 	slug := Slugify(uri)
 
 	fn := filepath.Join(conf.Data, externalDir, fmt.Sprintf("%s.webp", slug))
@@ -211,6 +263,12 @@ func GetExternalAvatar(conf *Config, nick, uri string) string {
 		return URLForExternalAvatar(conf, uri)
 	}
 
+	if meta != nil && meta.Avatar != "" {
+		if err := DownloadExternalAvatar(conf, uri, meta.Avatar); err == nil {
+			return URLForExternalAvatar(conf, uri)
+		}
+	}
+
 	if !strings.HasSuffix(uri, "/") {
 		uri += "/"
 	}
@@ -252,6 +310,14 @@ func GetExternalAvatar(conf *Config, nick, uri string) string {
 	return ""
 }
 
+// userAgent is the User-Agent the pod identifies itself with fetching feeds
+func userAgent(conf *Config) string {
+	return fmt.Sprintf(
+		"twtxt/%s (Pod: %s Support: %s)",
+		twtxt.FullVersion(), conf.Name, URLForPage(conf.BaseURL, "support"),
+	)
+}
+
 func Request(conf *Config, method, url string, headers http.Header) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
@@ -265,13 +331,7 @@ func Request(conf *Config, method, url string, headers http.Header) (*http.Respo
 
 	// Set a default User-Agent (if none set)
 	if headers.Get("User-Agent") == "" {
-		headers.Set(
-			"User-Agent",
-			fmt.Sprintf(
-				"twtxt/%s (Pod: %s Support: %s)",
-				twtxt.FullVersion(), conf.Name, URLForPage(conf.BaseURL, "support"),
-			),
-		)
+		headers.Set("User-Agent", userAgent(conf))
 	}
 
 	req.Header = headers
@@ -289,6 +349,25 @@ func Request(conf *Config, method, url string, headers http.Header) (*http.Respo
 	return res, nil
 }
 
+// PermanentRedirect returns the url a response was redirected to if every
+// redirect followed to get there was permanent (301 Moved Permanently or
+// 308 Permanent Redirect)
+func PermanentRedirect(res *http.Response) (string, bool) {
+	if res.Request == nil || res.Request.Response == nil {
+		return "", false
+	}
+
+	for req := res.Request; req.Response != nil; req = req.Response.Request {
+		switch req.Response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		default:
+			return "", false
+		}
+	}
+
+	return res.Request.URL.String(), true
+}
+
 func ResourceExists(conf *Config, url string) bool {
 	res, err := Request(conf, http.MethodHead, url, nil)
 	if err != nil {
@@ -404,6 +483,24 @@ func IsLocalURLFactory(conf *Config) func(url string) bool {
 	}
 }
 
+// EditableFeedFactory returns a function that returns the name of the local
+// feed a twt was posted to if it is the user's own feed or one of the feeds
+// they own (and can edit and delete the twt from) or "" otherwise
+func EditableFeedFactory(conf *Config) func(user *User, twt types.Twt) string {
+	return func(user *User, twt types.Twt) string {
+		if user == nil || user.Username == "" {
+			return ""
+		}
+		twterURL := NormalizeURL(twt.Twter().URL)
+		for _, name := range append([]string{user.Username}, user.Feeds...) {
+			if twterURL == NormalizeURL(URLForUser(conf, name)) {
+				return name
+			}
+		}
+		return ""
+	}
+}
+
 func GetUserFromURL(conf *Config, db Store, url string) (*User, error) {
 	if !strings.HasPrefix(url, conf.BaseURL) {
 		return nil, fmt.Errorf("error: %s does not match our base url of %s", url, conf.BaseURL)
@@ -1081,6 +1178,14 @@ func NormalizeFeedName(name string) string {
 }
 
 func ValidateFeed(conf *Config, nick, url string) error {
+	// Feeds of this pod are not fetched from ourselves, see LoadFeed()
+	if name, ok := localFeedName(conf, url); ok {
+		if !FeedExists(conf, name) {
+			return ErrBadRequest
+		}
+		return nil
+	}
+
 	res, err := Request(conf, http.MethodGet, url, nil)
 	if err != nil {
 		log.WithError(err).Errorf("error fetching feed %s", url)
@@ -1094,7 +1199,7 @@ func ValidateFeed(conf *Config, nick, url string) error {
 
 	limitedReader := &io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit}
 	twter := types.Twter{Nick: nick, URL: url}
-	_, _, err = types.ParseFile(limitedReader, twter, conf.MaxCacheTTL, conf.MaxCacheItems)
+	_, _, _, err = types.ParseFile(limitedReader, twter, conf.MaxCacheTTL, conf.MaxCacheItems)
 	if err != nil {
 		return err
 	}
@@ -1258,6 +1363,16 @@ func URLForUser(conf *Config, username string) string {
 	)
 }
 
+// URLForFeedArchive returns the url of the archive file name twts of the
+// local feed username have been rotated into, see RotateFeed()
+func URLForFeedArchive(conf *Config, username, name string) string {
+	return fmt.Sprintf(
+		"%s/user/%s/archive/%s",
+		strings.TrimSuffix(conf.BaseURL, "/"),
+		username, name,
+	)
+}
+
 func URLForAvatar(conf *Config, username string) string {
 	return fmt.Sprintf(
 		"%s/user/%s/avatar",
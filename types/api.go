@@ -57,6 +57,9 @@ func NewRegisterRequest(r io.Reader) (req RegisterRequest, err error) {
 type PostRequest struct {
 	PostAs string `json:"post_as"`
 	Text   string `json:"text"`
+
+	// Hash is the hash of the twt to edit (or delete)
+	Hash string `json:"hash"`
 }
 
 // NewPostRequest ...
@@ -161,6 +164,70 @@ func NewConversationRequest(r io.Reader) (req ConversationRequest, err error) {
 	return
 }
 
+// SearchRequest ...
+type SearchRequest struct {
+	Query  string `json:"query"`
+	Tag    string `json:"tag"`
+	Cursor string `json:"cursor"`
+}
+
+// NewSearchRequest ...
+func NewSearchRequest(r io.Reader) (req SearchRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// SearchResponse ...
+type SearchResponse struct {
+	Twts   Twts   `json:"twts"`
+	Cursor string `json:"cursor"`
+}
+
+// Bytes ...
+func (res SearchResponse) Bytes() ([]byte, error) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// LintRequest is a request to lint either the feed at URL or the contents of
+// a feed in Feed
+type LintRequest struct {
+	URL  string `json:"url"`
+	Feed string `json:"feed"`
+}
+
+// NewLintRequest ...
+func NewLintRequest(r io.Reader) (req LintRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// LintResponse ...
+type LintResponse struct {
+	Valid  bool        `json:"valid"`
+	Report *LintReport `json:"report"`
+}
+
+// Bytes ...
+func (res LintResponse) Bytes() ([]byte, error) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
 // FetchTwtsRequest ...
 type FetchTwtsRequest struct {
 	URL  string `json:"url"`
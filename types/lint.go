@@ -0,0 +1,32 @@
+package types
+
+import (
+	"fmt"
+)
+
+// LintError is a problem with a line of a feed found by LintFile(), Line is
+// 0 for problems with the feed as a whole
+type LintError struct {
+	Line    int    `json:"line"`
+	Text    string `json:"text"`
+	Message string `json:"message"`
+}
+
+func (e LintError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// LintReport is the outcome of strictly validating a feed with LintFile()
+type LintReport struct {
+	Lines  int         `json:"lines"`
+	Twts   int         `json:"twts"`
+	Errors []LintError `json:"errors"`
+}
+
+// Valid returns true if no problems were found with the feed
+func (r *LintReport) Valid() bool {
+	return len(r.Errors) == 0
+}
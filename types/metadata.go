@@ -0,0 +1,180 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FeedLink is a link a feed declares with `# link = title url`
+type FeedLink struct {
+	Title string
+	URL   string
+}
+
+// FeedArchive is an archived part of a feed declared with `# prev = hash url`
+// where hash is the hash of the last twt in the archived part and url is
+// relative to the feed (or archived part) declaring it
+type FeedArchive struct {
+	Hash string
+	URL  string
+}
+
+// Metadata is what a feed declares about itself in `# key = value` comment
+// headers, conventionally at the top of the feed:
+//
+//	# nick        = alice
+//	# url         = https://example.com/twtxt.txt
+//	# avatar      = https://example.com/avatar.png
+//	# description = Hello from Alice
+//	# follow      = bob https://example.org/twtxt.txt
+//	# link        = My Blog https://example.com/blog
+//	# prev        = 1a2b3c4 twtxt-2020-11-10.txt
+//
+// follow and link may be repeated. Comments that are not headers and unknown
+// keys are ignored.
+type Metadata struct {
+	Nick        string
+	URL         string
+	Avatar      string
+	Description string
+	Follow      []Feed
+	Links       []FeedLink
+	Prev        *FeedArchive
+}
+
+// IsZero returns true if the feed declared no metadata
+func (m *Metadata) IsZero() bool {
+	return m == nil || (m.Nick == "" && m.URL == "" && m.Avatar == "" &&
+		m.Description == "" && len(m.Follow) == 0 && len(m.Links) == 0 &&
+		m.Prev == nil)
+}
+
+// Following returns the feeds declared with `# follow` as a map of nick to url
+func (m *Metadata) Following() map[string]string {
+	following := make(map[string]string)
+	if m == nil {
+		return following
+	}
+	for _, feed := range m.Follow {
+		following[feed.Nick] = feed.URL
+	}
+	return following
+}
+
+// splitLast splits s into everything up to the last field and the last
+// field, as in the `nick url` of `# follow` and `title url` of `# link`
+func splitLast(s string) (string, string) {
+	i := strings.LastIndexAny(s, " \t")
+	if i == -1 {
+		return "", s
+	}
+	return strings.TrimSpace(s[:i]), s[i+1:]
+}
+
+// metadataKeys are the keys of the headers Metadata understands
+var metadataKeys = map[string]bool{
+	"nick":        true,
+	"url":         true,
+	"avatar":      true,
+	"description": true,
+	"follow":      true,
+	"link":        true,
+	"prev":        true,
+}
+
+// IsMetadataKey returns true if key is the key of a header Metadata
+// understands
+func IsMetadataKey(key string) bool {
+	return metadataKeys[key]
+}
+
+// ParseHeader splits a comment line of a feed shaped like a `# key = value`
+// header into its (lower cased) key and value, ok is false for comments that
+// are not headers. The key must be a single word.
+func ParseHeader(line string) (key, value string, ok bool) {
+	if !strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(line, "#"), "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	key = strings.ToLower(strings.TrimSpace(parts[0]))
+	if key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", false
+	}
+
+	return key, strings.TrimSpace(parts[1]), true
+}
+
+// ParseLine parses a comment line of a feed as a `# key = value` header into
+// the metadata and returns false if the line is not a header.
+func (m *Metadata) ParseLine(line string) bool {
+	key, value, ok := ParseHeader(line)
+	if !ok || value == "" {
+		return false
+	}
+
+	switch key {
+	case "nick":
+		m.Nick = value
+	case "url":
+		m.URL = value
+	case "avatar":
+		m.Avatar = value
+	case "description":
+		m.Description = value
+	case "follow":
+		nick, url := splitLast(value)
+		if nick == "" {
+			return false
+		}
+		m.Follow = append(m.Follow, Feed{Nick: nick, URL: url})
+	case "link":
+		title, url := splitLast(value)
+		if title == "" {
+			title = url
+		}
+		m.Links = append(m.Links, FeedLink{Title: title, URL: url})
+	case "prev":
+		fields := strings.Fields(value)
+		if len(fields) != 2 {
+			return false
+		}
+		m.Prev = &FeedArchive{Hash: fields[0], URL: fields[1]}
+	default:
+		return false
+	}
+
+	return true
+}
+
+// String returns the metadata formatted as `# key = value` headers to be
+// written at the top of a feed
+func (m *Metadata) String() string {
+	var b strings.Builder
+
+	header := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "# %-11s = %s\n", key, value)
+		}
+	}
+
+	header("nick", m.Nick)
+	header("url", m.URL)
+	header("avatar", m.Avatar)
+	header("description", strings.Join(strings.Fields(m.Description), " "))
+	for _, feed := range m.Follow {
+		header("follow", fmt.Sprintf("%s %s", feed.Nick, feed.URL))
+	}
+	for _, link := range m.Links {
+		header("link", fmt.Sprintf("%s %s", link.Title, link.URL))
+	}
+	if m.Prev != nil {
+		header("prev", fmt.Sprintf("%s %s", m.Prev.Hash, m.Prev.URL))
+	}
+
+	return b.String()
+}
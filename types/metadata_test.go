@@ -0,0 +1,69 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("ParseLine", func(t *testing.T) {
+		var m Metadata
+		assert.True(m.IsZero())
+
+		assert.True(m.ParseLine("# nick = alice"))
+		assert.True(m.ParseLine("#url=https://example.com/twtxt.txt"))
+		assert.True(m.ParseLine("# AVATAR = https://example.com/avatar.png"))
+		assert.True(m.ParseLine("# description = Hello = World"))
+		assert.True(m.ParseLine("# follow = bob https://example.org/twtxt.txt"))
+		assert.True(m.ParseLine("# link = My Blog https://example.com/blog"))
+		assert.True(m.ParseLine("# link = https://example.com"))
+		assert.True(m.ParseLine("# prev = 1a2b3c4 twtxt-2020-11-10.txt"))
+
+		assert.False(m.ParseLine("# Just a comment"))
+		assert.False(m.ParseLine("# nick ="))
+		assert.False(m.ParseLine("# unknown = value"))
+		assert.False(m.ParseLine("# follow = https://example.org/twtxt.txt"))
+		assert.False(m.ParseLine("# prev = twtxt-2020-11-10.txt"))
+		assert.False(m.ParseLine("2020-12-01T00:00:00Z\tnick = bob"))
+
+		assert.False(m.IsZero())
+		assert.Equal("alice", m.Nick)
+		assert.Equal("https://example.com/twtxt.txt", m.URL)
+		assert.Equal("https://example.com/avatar.png", m.Avatar)
+		assert.Equal("Hello = World", m.Description)
+		assert.Equal([]Feed{{Nick: "bob", URL: "https://example.org/twtxt.txt"}}, m.Follow)
+		assert.Equal(map[string]string{"bob": "https://example.org/twtxt.txt"}, m.Following())
+		assert.Equal([]FeedLink{
+			{Title: "My Blog", URL: "https://example.com/blog"},
+			{Title: "https://example.com", URL: "https://example.com"},
+		}, m.Links)
+		assert.Equal(&FeedArchive{Hash: "1a2b3c4", URL: "twtxt-2020-11-10.txt"}, m.Prev)
+	})
+
+	t.Run("String", func(t *testing.T) {
+		m := &Metadata{
+			Nick:        "alice",
+			Description: "Hello\nWorld",
+			Follow:      []Feed{{Nick: "bob", URL: "https://example.org/twtxt.txt"}},
+		}
+		s := m.String()
+		assert.Equal(
+			"# nick        = alice\n"+
+				"# description = Hello World\n"+
+				"# follow      = bob https://example.org/twtxt.txt\n",
+			s,
+		)
+
+		var parsed Metadata
+		for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+			assert.True(parsed.ParseLine(line))
+		}
+		assert.Equal(m.Nick, parsed.Nick)
+		assert.Equal("Hello World", parsed.Description)
+		assert.Equal(m.Follow, parsed.Follow)
+	})
+}
@@ -21,6 +21,9 @@ type Profile struct {
 
 	Followers map[string]string
 	Following map[string]string
+
+	// Links declared by an external feed in its metadata
+	Links []FeedLink
 }
 
 type Link struct {
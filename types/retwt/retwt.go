@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"regexp"
 	"sort"
 	"strings"
@@ -124,12 +125,13 @@ func ParseLine(line string, twter types.Twter) (twt types.Twt, err error) {
 	return
 }
 
-func ParseFile(r io.Reader, twter types.Twter, ttl time.Duration, N int) (types.Twts, types.Twts, error) {
+func ParseFile(r io.Reader, twter types.Twter, ttl time.Duration, N int) (types.Twts, types.Twts, *types.Metadata, error) {
 	scanner := bufio.NewScanner(r)
 
 	var (
 		twts types.Twts
 		old  types.Twts
+		meta types.Metadata
 	)
 
 	oldTime := time.Now().Add(-ttl)
@@ -140,6 +142,12 @@ func ParseFile(r io.Reader, twter types.Twter, ttl time.Duration, N int) (types.
 		line := scanner.Text()
 		nLines++
 
+		// Comments are either metadata headers or ignored
+		if strings.HasPrefix(line, "#") {
+			meta.ParseLine(line)
+			continue
+		}
+
 		twt, err := ParseLine(line, twter)
 		if err != nil {
 			nErrors++
@@ -156,12 +164,12 @@ func ParseFile(r io.Reader, twter types.Twter, ttl time.Duration, N int) (types.
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	if (nLines+nErrors > 0) && nLines == nErrors {
 		log.Warnf("erroneous feed dtected (nLines + nErrors > 0 && nLines == nErrors): %d/%d", nLines, nErrors)
-		return nil, nil, ErrInvalidFeed
+		return nil, nil, nil, ErrInvalidFeed
 	}
 
 	// Sort by CreatedAt timestamp
@@ -177,7 +185,126 @@ func ParseFile(r io.Reader, twter types.Twter, ttl time.Duration, N int) (types.
 		old = append(old, twts[N:]...)
 	}
 
-	return twts, old, nil
+	return twts, old, &meta, nil
+}
+
+// lintFutureSlack is how far in the future a twt's timestamp can be before
+// it is reported by LintFile, to allow for clocks being slightly off
+const lintFutureSlack = 5 * time.Minute
+
+// lintMentions returns the problems with the @<nick url> mentions of text
+func lintMentions(text string) []string {
+	var problems []string
+
+	for rest := text; ; {
+		i := strings.Index(rest, "@<")
+		if i == -1 {
+			break
+		}
+		rest = rest[i+2:]
+
+		j := strings.IndexByte(rest, '>')
+		if j == -1 {
+			problems = append(problems, "unterminated mention, missing >")
+			break
+		}
+		mention := rest[:j]
+		rest = rest[j+1:]
+
+		// Either @<nick url> or @<url>
+		fields := strings.Fields(mention)
+		if len(fields) == 0 || len(fields) > 2 {
+			problems = append(problems, fmt.Sprintf("invalid mention @<%s>, expected @<nick url>", mention))
+			continue
+		}
+		u, err := url.Parse(fields[len(fields)-1])
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("invalid url in mention @<%s>", mention))
+		}
+	}
+
+	return problems
+}
+
+// LintFile strictly validates a feed reporting every problem found with its
+// lines, unlike ParseFile which skips the lines it cannot parse.
+func LintFile(r io.Reader, twter types.Twter) (*types.LintReport, error) {
+	scanner := bufio.NewScanner(r)
+
+	var (
+		report = &types.LintReport{}
+		hashes = make(map[string]int)
+		now    = time.Now()
+	)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		report.Lines++
+
+		n := report.Lines
+		fail := func(format string, args ...interface{}) {
+			report.Errors = append(report.Errors, types.LintError{
+				Line: n, Text: line, Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			key, value, ok := types.ParseHeader(line)
+			if !ok {
+				continue
+			}
+			var meta types.Metadata
+			if !types.IsMetadataKey(key) {
+				fail("unknown header %q", key)
+			} else if !meta.ParseLine(line) {
+				fail("invalid %s header %q", key, value)
+			}
+			continue
+		}
+
+		i := strings.IndexByte(line, '\t')
+		if i == -1 {
+			fail("missing tab between timestamp and text")
+			continue
+		}
+
+		created, err := ParseTime(line[:i])
+		if err != nil {
+			fail("invalid timestamp %q, expected RFC 3339 (e.g. %s)", line[:i], now.Format(time.RFC3339))
+			continue
+		}
+		if created.After(now.Add(lintFutureSlack)) {
+			fail("timestamp %s is in the future", line[:i])
+		}
+
+		text := line[i+1:]
+		if strings.TrimSpace(text) == "" {
+			fail("empty twt")
+			continue
+		}
+
+		twt := &reTwt{twter: twter, created: created, text: text}
+		if prev, ok := hashes[twt.Hash()]; ok {
+			fail("duplicate of the twt on line %d (#%s)", prev, twt.Hash())
+		} else {
+			hashes[twt.Hash()] = n
+		}
+
+		for _, problem := range lintMentions(text) {
+			fail("%s", problem)
+		}
+
+		report.Twts++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
 }
 
 func (twt *reTwt) Twter() types.Twter { return twt.twter }
@@ -394,9 +521,12 @@ func (*retwtManager) DecodeJSON(b []byte) (types.Twt, error) { return DecodeJSON
 func (*retwtManager) ParseLine(line string, twter types.Twter) (twt types.Twt, err error) {
 	return ParseLine(line, twter)
 }
-func (*retwtManager) ParseFile(r io.Reader, twter types.Twter, ttl time.Duration, N int) (types.Twts, types.Twts, error) {
+func (*retwtManager) ParseFile(r io.Reader, twter types.Twter, ttl time.Duration, N int) (types.Twts, types.Twts, *types.Metadata, error) {
 	return ParseFile(r, twter, ttl, N)
 }
+func (*retwtManager) LintFile(r io.Reader, twter types.Twter) (*types.LintReport, error) {
+	return LintFile(r, twter)
+}
 
 func DefaultTwtManager() {
 	types.SetTwtManager(&retwtManager{})
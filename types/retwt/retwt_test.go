@@ -2,6 +2,7 @@ package retwt_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -130,3 +131,47 @@ func TestHash(t *testing.T) {
 		})
 	}
 }
+
+func TestLintFile(t *testing.T) {
+	assert := assert.New(t)
+
+	future := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	feed := strings.Join([]string{
+		"# nick = alice",
+		"# lang = en",
+		"# follow = https://example.com/twtxt.txt",
+		"# Just a comment",
+		"",
+		"2020-12-01T00:00:00Z\tHello @<bob https://example.com/twtxt.txt>",
+		"2020-12-01T00:00:00Z Hello with spaces",
+		"yesterday\tHello",
+		future + "\tHello from the future",
+		"2020-12-01T00:00:00Z\tHello @<bob https://example.com/twtxt.txt>",
+		"2020-12-02T00:00:00Z\tHello @<bob> and @<carol https://example.com",
+		"2020-12-03T00:00:00Z\t ",
+	}, "\n")
+
+	report, err := retwt.LintFile(strings.NewReader(feed), types.Twter{URL: "https://example.com/alice.txt"})
+	assert.NoError(err)
+	assert.False(report.Valid())
+	assert.Equal(12, report.Lines)
+	assert.Equal(4, report.Twts)
+
+	var lines []int
+	for _, e := range report.Errors {
+		lines = append(lines, e.Line)
+	}
+	assert.Equal([]int{2, 3, 7, 8, 9, 10, 11, 11, 12}, lines)
+	assert.Equal(`line 2: unknown header "lang"`, report.Errors[0].Error())
+	assert.Contains(report.Errors[2].Message, "missing tab")
+	assert.Contains(report.Errors[3].Message, "invalid timestamp")
+	assert.Contains(report.Errors[4].Message, "in the future")
+	assert.Contains(report.Errors[5].Message, "duplicate of the twt on line 6")
+	assert.Contains(report.Errors[6].Message, "invalid url in mention @<bob>")
+	assert.Contains(report.Errors[7].Message, "unterminated mention")
+	assert.Contains(report.Errors[8].Message, "empty twt")
+
+	report, err = retwt.LintFile(strings.NewReader("# nick = alice\n2020-12-01T00:00:00Z\tHello\n"), types.Twter{})
+	assert.NoError(err)
+	assert.True(report.Valid())
+}
@@ -144,7 +144,8 @@ func init() {
 type TwtManager interface {
 	DecodeJSON([]byte) (Twt, error)
 	ParseLine(line string, twter Twter) (twt Twt, err error)
-	ParseFile(r io.Reader, twter Twter, ttl time.Duration, N int) (Twts, Twts, error)
+	ParseFile(r io.Reader, twter Twter, ttl time.Duration, N int) (Twts, Twts, *Metadata, error)
+	LintFile(r io.Reader, twter Twter) (*LintReport, error)
 }
 
 type nilManager struct{}
@@ -153,7 +154,10 @@ func (*nilManager) DecodeJSON([]byte) (Twt, error) { panic("twt managernot confi
 func (*nilManager) ParseLine(line string, twter Twter) (twt Twt, err error) {
 	panic("twt managernot configured")
 }
-func (*nilManager) ParseFile(r io.Reader, twter Twter, ttl time.Duration, N int) (Twts, Twts, error) {
+func (*nilManager) ParseFile(r io.Reader, twter Twter, ttl time.Duration, N int) (Twts, Twts, *Metadata, error) {
+	panic("twt managernot configured")
+}
+func (*nilManager) LintFile(r io.Reader, twter Twter) (*LintReport, error) {
 	panic("twt managernot configured")
 }
 
@@ -165,9 +169,12 @@ func DecodeJSON(b []byte) (Twt, error) { return twtManager.DecodeJSON(b) }
 func ParseLine(line string, twter Twter) (twt Twt, err error) {
 	return twtManager.ParseLine(line, twter)
 }
-func ParseFile(r io.Reader, twter Twter, ttl time.Duration, N int) (Twts, Twts, error) {
+func ParseFile(r io.Reader, twter Twter, ttl time.Duration, N int) (Twts, Twts, *Metadata, error) {
 	return twtManager.ParseFile(r, twter, ttl, N)
 }
+func LintFile(r io.Reader, twter Twter) (*LintReport, error) {
+	return twtManager.LintFile(r, twter)
+}
 
 func SetTwtManager(m TwtManager) {
 	twtManager = m